@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/geofpwhite/gorep/search"
+	"github.com/rivo/uniseg"
+)
+
+// ellipsis stands for the text -max-columns-preview leaves out of a line.
+const ellipsis = "…"
+
+// writeLongLine writes, in place of line[head:tail] which is wider than -max-columns, a
+// notice giving its number of matches or, with -max-columns-preview, the text around
+// each of them: windows of -max-columns, matches included, separated by ellipses.
+func (c *config) writeLongLine(b *strings.Builder, m search.Match, line string, spans []lineSpan, head, tail int) {
+	if !c.maxColumnsPreview || len(spans) == 0 {
+		noun := "matches"
+		if len(spans) == 1 {
+			noun = "match"
+		}
+		fmt.Fprintf(b, "[omitted long line with %d %s]", len(spans), noun)
+		return
+	}
+	windows := previewWindows(line, spans, head, tail, c.maxColumns)
+	for _, w := range windows {
+		if w.from > head {
+			b.WriteString(ellipsis)
+		}
+		var inside []lineSpan
+		for _, s := range spans {
+			if (s.from < w.to && s.to > w.from) || (s.from == s.to && s.from >= w.from && s.from <= w.to) {
+				inside = append(inside, s)
+			}
+		}
+		c.writeSpans(b, m, line, inside, w.from, w.to)
+	}
+	if windows[len(windows)-1].to < tail {
+		b.WriteString(ellipsis)
+	}
+}
+
+// window is a part of a line shown by -max-columns-preview.
+type window struct {
+	from, to int
+}
+
+// previewWindows returns the parts of line[head:tail] to show for spans: each match,
+// cut down to maxColumns if needed, and the text on both sides of it filling the rest of
+// maxColumns. Windows that overlap are merged.
+func previewWindows(line string, spans []lineSpan, head, tail, maxColumns int) []window {
+	var windows []window
+	for _, s := range spans {
+		from, to := min(max(s.from, head), tail), min(max(s.to, head), tail)
+		room := maxColumns - uniseg.StringWidth(line[from:to])
+		if room < 0 {
+			to, _ = forwardColumns(line, from, tail, maxColumns)
+			room = 0
+		}
+		left, used := backColumns(line, from, head, room/2)
+		right, _ := forwardColumns(line, to, tail, room-used)
+		if n := len(windows); n > 0 && left <= windows[n-1].to {
+			windows[n-1].from = min(windows[n-1].from, left)
+			windows[n-1].to = max(windows[n-1].to, right)
+			continue
+		}
+		windows = append(windows, window{left, right})
+	}
+	return windows
+}
+
+// forwardColumns returns how far from start, up to limit, line can go within columns,
+// and the width of what that takes.
+func forwardColumns(line string, start, limit, columns int) (int, int) {
+	used := 0
+	for start < limit {
+		r, size := utf8.DecodeRuneInString(line[start:limit])
+		w := uniseg.StringWidth(string(r))
+		if used+w > columns {
+			break
+		}
+		used += w
+		start += size
+	}
+	return start, used
+}
+
+// backColumns is forwardColumns going back from end, down to limit.
+func backColumns(line string, end, limit, columns int) (int, int) {
+	used := 0
+	for end > limit {
+		r, size := utf8.DecodeLastRuneInString(line[limit:end])
+		w := uniseg.StringWidth(string(r))
+		if used+w > columns {
+			break
+		}
+		used += w
+		end -= size
+	}
+	return end, used
+}
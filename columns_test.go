@@ -0,0 +1,49 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestMaxColumns(t *testing.T) {
+	long := "    " + strings.Repeat("a", 30) + " test " + strings.Repeat("b", 30) + " test"
+	tests := []struct {
+		name    string
+		input   string
+		preview bool
+		want    string
+	}{
+		{name: "Short", input: "  a test", want: "1. a test\n"},
+		{name: "Omitted", input: long + "\nshort test", want: "1. [omitted long line with 2 matches]\n2. short test\n"},
+		{name: "Preview", input: long, preview: true, want: "1. …aaaaaaa test bbbbbbb…bbbbbbb test\n"},
+		{name: "Merged", input: "xxxxxxxxxxxx test test xxxxxxxxxxxx", preview: true, want: "1. …xxxxxxx test test xxxxxxx…\n"},
+		{name: "LongMatch", input: "te" + strings.Repeat("s", 40) + "t", preview: true, want: "1. te" + strings.Repeat("s", 18) + "…\n"},
+		{name: "Wide", input: "世界世界世界世界 test 世界世界", preview: true, want: "1. …界世界 test 世界世界\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConfig(search.Regexp(regexp.MustCompile("tes+t")), true, "", "", nil, 1)
+			c.maxColumns = 20
+			c.maxColumnsPreview = tt.preview
+			if got := stripColors(c.matchToString(tt.input, "")); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMaxColumnsFlags(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "--max-columns=80", "--max-columns-preview", "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.maxColumns != 80 || !c.maxColumnsPreview {
+		t.Errorf("Expected -max-columns 80 with a preview, got %d and %v", c.maxColumns, c.maxColumnsPreview)
+	}
+	if _, err := ConfigureWithArgs([]string{"gorep", "-max-columns-preview", "test"}); err == nil {
+		t.Error("Expected an error for -max-columns-preview without -max-columns")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// withDefaults returns args with the default arguments of the config file and then of
+// GOREP_OPTS inserted before the command line ones, which come last and so take
+// precedence. -no-config on the command line leaves the config file out.
+func withDefaults(args []string) ([]string, error) {
+	if len(args) < 2 || isIndexCommand(args) {
+		return args, nil
+	}
+	var defaults []string
+	if !noConfig(args[1:]) {
+		fileArgs, err := configFileArgs()
+		if err != nil {
+			return nil, err
+		}
+		defaults = append(defaults, fileArgs...)
+	}
+	envArgs, err := splitArgs(os.Getenv("GOREP_OPTS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GOREP_OPTS: %w", err)
+	}
+	defaults = append(defaults, envArgs...)
+	if len(defaults) == 0 {
+		return args, nil
+	}
+	return append(append([]string{args[0]}, defaults...), args[1:]...), nil
+}
+
+// noConfig tells whether the command line args hold -no-config, before any "--".
+func noConfig(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "-no-config", "--no-config", "-no-config=true", "--no-config=true":
+			return true
+		}
+	}
+	return false
+}
+
+// configPath returns the path of the config file: GOREP_CONFIG_PATH when set, and
+// gorep/config under $XDG_CONFIG_HOME, or ~/.config, otherwise. explicit tells it was
+// given, in which case it has to exist.
+func configPath() (path string, explicit bool) {
+	if path := os.Getenv("GOREP_CONFIG_PATH"); path != "" {
+		return path, true
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gorep", "config"), false
+}
+
+// configFileArgs reads the arguments of the config file, each line being split like
+// GOREP_OPTS, blank lines and lines starting with # being skipped.
+func configFileArgs() ([]string, error) {
+	path, explicit := configPath()
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read the config file: %w", err)
+	}
+	defer f.Close()
+
+	var args []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lineArgs, err := splitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file line %d: %w", n, err)
+		}
+		args = append(args, lineArgs...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read the config file: %w", err)
+	}
+	return args, nil
+}
+
+// splitArgs splits s into arguments like a shell would: on blanks, except within
+// single or double quotes, a backslash escaping the next character outside of single
+// quotes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
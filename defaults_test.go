@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestWithDefaults(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("GOREP_CONFIG_PATH", "")
+	t.Setenv("GOREP_OPTS", "")
+
+	args := []string{"gorep", "-workers", "4", "test"}
+	if got, err := withDefaults(args); err != nil || !slices.Equal(got, args) {
+		t.Errorf("Expected the arguments unchanged without defaults, got %q (%v)", got, err)
+	}
+
+	os.Mkdir(filepath.Join(configHome, "gorep"), 0o755)
+	os.WriteFile(filepath.Join(configHome, "gorep", "config"),
+		[]byte("# team defaults\n-workers 2\n\n  -ignore\nvendor\n-ignore-case -ignore 'build output'\n"), 0o644)
+	t.Setenv("GOREP_OPTS", `-workers=3 -ignore "node modules"`)
+	got, err := withDefaults(args)
+	want := []string{"gorep", "-workers", "2", "-ignore", "vendor", "-ignore-case", "-ignore", "build output",
+		"-workers=3", "-ignore", "node modules", "-workers", "4", "test"}
+	if err != nil || !slices.Equal(got, want) {
+		t.Fatalf("Expected %q, got %q (%v)", want, got, err)
+	}
+	c, err := ConfigureWithArgs(got)
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.workers != 4 || !slices.Equal(c.ignore, []string{"vendor", "build output", "node modules"}) || !c.matcherOptions.IgnoreCase {
+		t.Errorf("Expected the command line to take precedence, got %d workers, ignoring %q", c.workers, c.ignore)
+	}
+
+	got, _ = withDefaults([]string{"gorep", "--no-config", "test"})
+	if want := []string{"gorep", "-workers=3", "-ignore", "node modules", "--no-config", "test"}; !slices.Equal(got, want) {
+		t.Errorf("Expected -no-config to leave the config file out, got %q", got)
+	}
+	if _, err := ConfigureWithArgs(got); err != nil {
+		t.Errorf("Expected -no-config to be accepted, got %v", err)
+	}
+
+	// The index command takes other flags.
+	index := []string{"gorep", "index", "build", "."}
+	if got, _ := withDefaults(index); !slices.Equal(got, index) {
+		t.Errorf("Expected no defaults for gorep index build, got %q", got)
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	t.Setenv("GOREP_OPTS", "")
+	t.Setenv("GOREP_CONFIG_PATH", filepath.Join(t.TempDir(), "missing"))
+	if _, err := withDefaults([]string{"gorep", "test"}); err == nil {
+		t.Error("Expected an error when the config file given with GOREP_CONFIG_PATH is missing")
+	}
+
+	custom := filepath.Join(t.TempDir(), "gorep.conf")
+	os.WriteFile(custom, []byte("-no-trim\n"), 0o644)
+	t.Setenv("GOREP_CONFIG_PATH", custom)
+	if got, _ := withDefaults([]string{"gorep", "test"}); !slices.Equal(got, []string{"gorep", "-no-trim", "test"}) {
+		t.Errorf("Expected the config file of GOREP_CONFIG_PATH to be read, got %q", got)
+	}
+	os.WriteFile(custom, []byte("-ignore \"unterminated\n"), 0o644)
+	if _, err := withDefaults([]string{"gorep", "test"}); err == nil {
+		t.Error("Expected an error for a config file line with an unterminated quote")
+	}
+
+	t.Setenv("GOREP_CONFIG_PATH", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/someone")
+	if path, explicit := configPath(); path != "/home/someone/.config/gorep/config" || explicit {
+		t.Errorf("Expected the config file under ~/.config, got %s", path)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: "  -a   -b\t-c ", want: []string{"-a", "-b", "-c"}},
+		{in: `-ignore "a b" -e 'x "y"'`, want: []string{"-ignore", "a b", "-e", `x "y"`}},
+		{in: `a\ b c\\d '\n' ""`, want: []string{"a b", `c\d`, `\n`, ""}},
+	}
+	for _, tt := range tests {
+		got, err := splitArgs(tt.in)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q (%v), want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`"open`, `'open`, `trailing\`} {
+		if _, err := splitArgs(in); err == nil {
+			t.Errorf("Expected an error splitting %q", in)
+		}
+	}
+}
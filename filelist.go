@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// printFiles prints, for -files, the files a search would read: those given and those
+// found in the directories given, or in the current one, minus the ones left out.
+func (c *config) printFiles(ctx context.Context, opf *os.File) error {
+	roots := c.paths
+	if len(roots) == 0 && c.filesFrom == "" {
+		roots = []string{"."}
+	}
+	// A list from find holds directories along with their files.
+	seen := make(map[string]bool)
+	for path, err := range c.searcher().Files(ctx, roots...) {
+		if err != nil {
+			log.Println(err)
+			c.failed.Store(true)
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			if seen[abs] {
+				continue
+			}
+			seen[abs] = true
+		}
+		// Each file listed counts as a match for the exit status.
+		c.matchedLines++
+		if c.quiet {
+			break
+		}
+		c.emit(path+c.afterName("\n"), opf)
+	}
+	if summary := c.skipSummary(); summary != "" && !c.noMessages {
+		log.Println(summary)
+	}
+	return nil
+}
+
+// fileName returns the name of the file at path as shown above its matches: its base
+// name in color, or with -null the whole path as is, for xargs -0 and the like.
+func (c *config) fileName(path string) string {
+	if c.null {
+		return path + "\x00"
+	}
+	return BLUE + filepath.Base(path) + ": "
+}
+
+// afterName returns what follows a file name in the output: sep, or a NUL byte with
+// -null so that names holding any character can be told apart.
+func (c *config) afterName(sep string) string {
+	if c.null {
+		return "\x00"
+	}
+	return sep
+}
+
+// readFilesFrom reads the paths listed in the file at path, or in stdin for "-", for
+// -files-from.
+func readFilesFrom(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read -files-from list: %w", err)
+	}
+	return splitPathList(data), nil
+}
+
+// splitPathList splits data into paths: separated by NUL bytes if it holds any, as
+// find -print0 and git ls-files -z write them, and by newlines otherwise. Empty entries
+// are dropped.
+func splitPathList(data []byte) []string {
+	sep, trim := "\n", "\r"
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep, trim = "\x00", ""
+	}
+	var paths []string
+	for path := range strings.SplitSeq(string(data), sep) {
+		if trim != "" {
+			path = strings.TrimSuffix(path, trim)
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
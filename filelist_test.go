@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitPathList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: "a.go\nsub dir/b.go\r\n\nc.go", want: []string{"a.go", "sub dir/b.go", "c.go"}},
+		{in: "a.go\x00new\nline.go\x00\x00", want: []string{"a.go", "new\nline.go"}},
+	}
+	for _, tt := range tests {
+		if got := splitPathList([]byte(tt.in)); !slices.Equal(got, tt.want) {
+			t.Errorf("splitPathList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFilesFrom(t *testing.T) {
+	tempDir := t.TempDir()
+	odd := filepath.Join(tempDir, "odd name\n.txt")
+	os.WriteFile(odd, []byte("a test\n"), 0o644)
+	plain := filepath.Join(tempDir, "plain.txt")
+	os.WriteFile(plain, []byte("no match\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "unlisted.txt"), []byte("test\n"), 0o644)
+	list := filepath.Join(tempDir, "list")
+	os.WriteFile(list, []byte(odd+"\x00"+plain+"\x00"), 0o644)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-files-from", list, "-vimgrep", "-null", "-o", outputPath, "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !slices.Equal(c.paths, []string{odd, plain}) {
+		t.Fatalf("Expected the listed paths, got %q", c.paths)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != odd+"\x001:3:a test\n" {
+		t.Errorf("Expected only the listed file to match, followed by a NUL byte, got %q", content)
+	}
+
+	// The list can come from stdin, and an empty one searches nothing.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	os.Stdin = r
+	w.Close()
+	c, err = ConfigureWithArgs([]string{"gorep", "-files-from", "-", "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 1 {
+		t.Errorf("Expected exit code 1 for an empty list, got %d", got)
+	}
+
+	for _, args := range [][]string{
+		{"gorep", "-files-from", filepath.Join(tempDir, "missing"), "test"},
+		{"gorep", "-files-from", list, "-text", "test", "some text"},
+	} {
+		if _, err := ConfigureWithArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestFilesFromFind(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "e", "sub"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "e", "x.txt"), []byte("foo\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "e", "sub", "y.txt"), []byte("foo\n"), 0o644)
+	t.Chdir(tempDir)
+	// What find e -print0 writes: the directories along with their files.
+	list := filepath.Join(t.TempDir(), "list")
+	os.WriteFile(list, []byte("e\x00e/sub\x00e/sub/y.txt\x00e/x.txt\x00"), 0o644)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-files", "-files-from", list, "-o", outputPath})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	c.Main(context.Background())
+	if content, _ := os.ReadFile(outputPath); string(content) != "e/sub/y.txt\ne/x.txt\n" {
+		t.Errorf("Expected each file to be listed once, got %q", content)
+	}
+
+	c, err = ConfigureWithArgs([]string{"gorep", "-files-from", list, "-write", "-replace", "B$0", "foo"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	for _, name := range []string{"e/x.txt", "e/sub/y.txt"} {
+		if content, _ := os.ReadFile(name); string(content) != "Bfoo\n" {
+			t.Errorf("Expected %s to be rewritten once, got %q", name, content)
+		}
+	}
+}
+
+func TestNullHeaders(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test\n"), 0o644)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-null", "-o", outputPath, "test", tempDir})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	c.Main(context.Background())
+	if content, _ := os.ReadFile(outputPath); string(content) != filepath.Join(tempDir, "a.txt")+"\x00\n1. test\n" {
+		t.Errorf("Expected the whole path followed by a NUL byte, got %q", content)
+	}
+}
+
+func TestPrintFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("b"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "c.log"), []byte("c"), 0o644)
+	t.Chdir(tempDir)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-files", "-ignore", "*.log", "-o", outputPath})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != "a.txt\nsub/b.txt\n" {
+		t.Errorf("Expected the files of the current directory, got %q", content)
+	}
+
+	outputPath = filepath.Join(t.TempDir(), "out.txt")
+	c, err = ConfigureWithArgs([]string{"gorep", "-files", "-null", "-o", outputPath, "sub", "missing"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 2 {
+		t.Errorf("Expected exit code 2 with a missing path, got %d", got)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != "sub/b.txt\x00" {
+		t.Errorf("Expected the files given, NUL-terminated, got %q", content)
+	}
+
+	c, err = ConfigureWithArgs([]string{"gorep", "-files", "-ignore", "*", "."})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 1 {
+		t.Errorf("Expected exit code 1 without files, got %d", got)
+	}
+
+	for _, args := range [][]string{
+		{"gorep", "-files", "-e", "test"},
+		{"gorep", "-files", "-text", "a"},
+		{"gorep", "-files", "-replace", "x"},
+		{"gorep", "-files", "-watch"},
+	} {
+		if _, err := ConfigureWithArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// parseFlags parses args with the flags defined in fs, like fs.Parse but letting flags
+// and arguments come in any order, and returns the arguments. "--" ends the flags, a
+// value can be given as -name=value or --name=value as well as in the next argument,
+// and single-letter flags can be combined (-wF), the last one taking a value if it needs
+// one (-wFf src). Errors are printed with the usage, as fs.Parse does.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(positional, args[i+1:]...), nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+
+		next := func() (string, bool) {
+			if i+1 < len(args) {
+				i++
+				return args[i], true
+			}
+			return "", false
+		}
+		long := arg[1] == '-'
+		name, value, hasValue := strings.Cut(arg[1:], "=")
+		if long {
+			name = name[1:]
+		}
+		var err error
+		if long || hasValue || len(name) == 1 || fs.Lookup(name) != nil {
+			err = setFlag(fs, name, value, hasValue, next)
+		} else {
+			err = setShortFlags(fs, name, next)
+		}
+		if err != nil {
+			return nil, usageError(fs, err)
+		}
+	}
+	return positional, nil
+}
+
+// setFlag sets the flag name to value or, when it's not given, to true for boolean
+// flags and to the next argument for the others.
+func setFlag(fs *flag.FlagSet, name, value string, hasValue bool, next func() (string, bool)) error {
+	f := fs.Lookup(name)
+	if f == nil {
+		if name == "h" || name == "help" {
+			return flag.ErrHelp
+		}
+		return fmt.Errorf("flag provided but not defined: -%s", name)
+	}
+	if !hasValue {
+		if isBoolFlag(f) {
+			value = "true"
+		} else if value, hasValue = next(); !hasValue {
+			return fmt.Errorf("flag needs an argument: -%s", name)
+		}
+	}
+	if err := fs.Set(name, value); err != nil {
+		return fmt.Errorf("invalid value %q for flag -%s: %v", value, name, err)
+	}
+	return nil
+}
+
+// setShortFlags sets the single-letter flags combined in names: boolean ones, except
+// maybe the last.
+func setShortFlags(fs *flag.FlagSet, names string, next func() (string, bool)) error {
+	for i := range len(names) {
+		f := fs.Lookup(names[i : i+1])
+		if f == nil || (!isBoolFlag(f) && i < len(names)-1) {
+			return fmt.Errorf("flag provided but not defined: -%s", names)
+		}
+		if err := setFlag(fs, f.Name, "", false, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// usageError prints err, unless it's a request for help, followed by the usage of fs.
+func usageError(fs *flag.FlagSet, err error) error {
+	if !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(fs.Output(), err)
+	}
+	if fs.Usage != nil {
+		fs.Usage()
+	} else {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+// newTestFlagSet returns a flag set with a few flags of each kind, and no output.
+func newTestFlagSet() (*flag.FlagSet, *bool, *bool, *string, *int) {
+	fs := flag.NewFlagSet("gorep", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	i := fs.Bool("i", false, "")
+	w := fs.Bool("w", false, "")
+	f := fs.String("f", "", "")
+	m := fs.Int("max-count", 0, "")
+	return fs, i, w, f, m
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		i, w       bool
+		f          string
+		m          int
+	}{
+		{args: []string{"TODO", "-f", "src", "-i"}, positional: []string{"TODO"}, i: true, f: "src"},
+		{args: []string{"-iw", "TODO"}, positional: []string{"TODO"}, i: true, w: true},
+		{args: []string{"-wif", "src", "TODO"}, positional: []string{"TODO"}, i: true, w: true, f: "src"},
+		{args: []string{"--max-count=3", "a", "-f=x", "b"}, positional: []string{"a", "b"}, f: "x", m: 3},
+		{args: []string{"--max-count", "3", "--i"}, i: true, m: 3},
+		{args: []string{"-i=false", "-"}, positional: []string{"-"}},
+		{args: []string{"-f", "-i", "--", "-w", "--", "x"}, positional: []string{"-w", "--", "x"}, f: "-i"},
+	}
+	for _, tt := range tests {
+		fs, i, w, f, m := newTestFlagSet()
+		positional, err := parseFlags(fs, tt.args)
+		if err != nil {
+			t.Errorf("parseFlags(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if !slices.Equal(positional, tt.positional) || *i != tt.i || *w != tt.w || *f != tt.f || *m != tt.m {
+			t.Errorf("parseFlags(%q) = %q, i=%v w=%v f=%q m=%d", tt.args, positional, *i, *w, *f, *m)
+		}
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-x"},
+		{"-ix"},
+		{"-fi", "src"}, // only the last combined flag can take a value
+		{"--iw"},
+		{"-f"},
+		{"--max-count=many"},
+		{"-i=maybe"},
+	} {
+		fs, _, _, _, _ := newTestFlagSet()
+		if _, err := parseFlags(fs, args); err == nil {
+			t.Errorf("Expected an error parsing %q", args)
+		}
+	}
+
+	fs, _, _, _, _ := newTestFlagSet()
+	if _, err := parseFlags(fs, []string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected -h to ask for help, got %v", err)
+	}
+}
+
+func TestInterspersedFlags(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "TODO", "-f", "src", "-Fw", "--workers=3"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !slices.Equal(c.paths, []string{"src"}) || c.workers != 3 || !c.matcherOptions.Fixed || !c.matcherOptions.Word {
+		t.Errorf("Expected the flags after the pattern to apply, got %+v", c)
+	}
+	if !slices.Equal(c.args, []string{"TODO"}) {
+		t.Errorf("Expected TODO to be the pattern, got %q", c.args)
+	}
+
+	c, err = ConfigureWithArgs([]string{"gorep", "-replace", "x", "-text", "test", "--", "-f", "text"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if len(c.paths) != 0 || !slices.Equal(c.args, []string{"test", "-f", "text"}) || !c.replacing {
+		t.Errorf("Expected the arguments after -- to be text to search, got %q", c.args)
+	}
+}
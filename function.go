@@ -0,0 +1,192 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+// defaultFunctionRegex is the -function-regex default, git's: a line starting with a
+// letter, "$" or "_" starts a declaration.
+const defaultFunctionRegex = `^[[:alpha:]$_]`
+
+// functions holds the declarations of a file, to write the one enclosing each match
+// above it with -show-function, or all of it with -function-context.
+type functions struct {
+	lines []string
+	decls []decl
+	// current is the declaration of the last match written, -1 if none, and printed the
+	// last line written.
+	current int
+	printed int
+}
+
+// decl is a declaration spanning lines start to end (1-based), start holding its header.
+type decl struct {
+	start, end int
+}
+
+// newFunctions finds the declarations of content, read from path: the top-level
+// functions, methods and types for Go files, and otherwise the lines re matches, each
+// one running until the next.
+func newFunctions(path string, content string, re *regexp.Regexp) *functions {
+	f := &functions{current: -1}
+	for line := range strings.Lines(content) {
+		line, _ = strings.CutSuffix(line, "\n")
+		f.lines = append(f.lines, strings.TrimSuffix(line, "\r"))
+	}
+	var ok bool
+	if filepath.Ext(path) == ".go" {
+		f.decls, ok = goDecls(content)
+	}
+	if !ok {
+		f.decls = regexDecls(f.lines, re)
+	}
+	return f
+}
+
+// goDecls returns the declarations of the Go source content, in order. ok is false when
+// it can't be parsed at all.
+func goDecls(content string) (decls []decl, ok bool) {
+	fset := token.NewFileSet()
+	file, _ := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	// Without a package clause, the parser gives up on the rest.
+	if file == nil || !file.Package.IsValid() {
+		return nil, false
+	}
+	add := func(n ast.Node) {
+		decls = append(decls, decl{fset.Position(n.Pos()).Line, fset.Position(n.End()).Line})
+	}
+	for _, d := range file.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			add(d)
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			if !d.Lparen.IsValid() {
+				add(d)
+				continue
+			}
+			// Each type of a group is a declaration of its own.
+			for _, spec := range d.Specs {
+				add(spec)
+			}
+		}
+	}
+	return decls, true
+}
+
+// regexDecls returns the declarations starting at the lines re matches.
+func regexDecls(lines []string, re *regexp.Regexp) []decl {
+	var decls []decl
+	for i, line := range lines {
+		if !re.MatchString(line) {
+			continue
+		}
+		if n := len(decls); n > 0 {
+			decls[n-1].end = i
+		}
+		decls = append(decls, decl{i + 1, len(lines)})
+	}
+	return decls
+}
+
+// showsFunctions tells whether the declarations enclosing the matches are shown.
+func (c *config) showsFunctions() bool {
+	return c.showFunction || c.functionContext
+}
+
+// readFunctions reads the file at path to find its declarations. If it can't be read,
+// its matches are written without them.
+func (c *config) readFunctions(path string) {
+	c.funcs = nil
+	if content, err := os.ReadFile(path); err == nil {
+		c.funcs = newFunctions(path, string(content), c.functionRegex)
+	}
+}
+
+// finishFunctions ends the writing of the matches of a file, see functions.finish.
+func (c *config) finishFunctions(b *strings.Builder) {
+	if c.funcs != nil {
+		c.funcs.finish(c, b)
+		c.funcs = nil
+	}
+}
+
+// enclosing returns the index of the declaration holding line, -1 if none does.
+func (f *functions) enclosing(line int) int {
+	i := sort.Search(len(f.decls), func(i int) bool { return f.decls[i].start > line }) - 1
+	if i >= 0 && f.decls[i].end >= line {
+		return i
+	}
+	return -1
+}
+
+// writeMatch writes m, preceded by the header of its declaration when it's the first
+// match in it or, with -function-context, by the lines of the declaration before it.
+func (f *functions) writeMatch(c *config, b *strings.Builder, m search.Match) {
+	d := f.enclosing(m.Line)
+	switch {
+	case c.functionContext:
+		if d != f.current {
+			f.finish(c, b)
+		}
+		if d >= 0 {
+			f.writeContext(c, b, d, max(f.decls[d].start, f.printed+1), m.Line-1)
+		}
+	case d >= 0 && d != f.current && f.decls[d].start < m.Line:
+		f.writeLine(c, b, f.decls[d].start, "=")
+	}
+	f.current = d
+	c.writeLines(b, m)
+	f.printed = m.EndLine
+}
+
+// finish writes, with -function-context, the rest of the declaration of the last match.
+func (f *functions) finish(c *config, b *strings.Builder) {
+	if c.functionContext && f.current >= 0 {
+		f.writeContext(c, b, f.current, f.printed+1, f.decls[f.current].end)
+	}
+	f.current = -1
+}
+
+// writeContext writes the lines from to to of the declaration d, its header labeled
+// "N= " and the others "N- ".
+func (f *functions) writeContext(c *config, b *strings.Builder, d, from, to int) {
+	for n := from; n <= to; n++ {
+		sep := "-"
+		if n == f.decls[d].start {
+			sep = "="
+		}
+		f.writeLine(c, b, n, sep)
+	}
+	f.printed = max(f.printed, to)
+}
+
+// writeLine writes line n, which isn't a match, labeled with sep instead of ".".
+func (f *functions) writeLine(c *config, b *strings.Builder, n int, sep string) {
+	if n < 1 || n > len(f.lines) {
+		return
+	}
+	line := f.lines[n-1]
+	if c.trim {
+		line = strings.TrimLeft(line, "\t ")
+	}
+	b.WriteString(RED)
+	b.WriteString(strconv.Itoa(n))
+	b.WriteString(sep)
+	b.WriteString(" ")
+	b.WriteString(WHITE)
+	b.WriteString(line)
+	b.WriteByte('\n')
+}
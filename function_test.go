@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+const functionSource = `package main
+
+// first does things.
+func first() error {
+	return nil
+}
+
+type (
+	a struct {
+		err error
+	}
+	b int
+)
+
+func (a) second() error {
+	if true {
+		return nil
+	}
+	return nil
+}
+`
+
+func TestGoDecls(t *testing.T) {
+	decls, ok := goDecls(functionSource)
+	want := []decl{{4, 6}, {9, 11}, {12, 12}, {15, 20}}
+	if !ok || !slices.Equal(decls, want) {
+		t.Errorf("Expected declarations %v, got %v", want, decls)
+	}
+	if _, ok := goDecls("not go"); ok {
+		t.Error("Expected non-Go source to fail parsing")
+	}
+}
+
+func TestRegexDecls(t *testing.T) {
+	lines := []string{"intro", "# One", "a", "# Two", "b"}
+	decls := regexDecls(lines, regexp.MustCompile("^#"))
+	if want := []decl{{2, 3}, {4, 5}}; !slices.Equal(decls, want) {
+		t.Errorf("Expected declarations %v, got %v", want, decls)
+	}
+}
+
+func TestShowFunction(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "main.go")
+	os.WriteFile(path, []byte(functionSource), 0o644)
+
+	tests := []struct {
+		name string
+		flag string
+		want string
+	}{
+		{name: "ShowFunction", flag: "-p", want: "4= func first() error {\n5. return nil\n" +
+			"15= func (a) second() error {\n17. return nil\n19. return nil\n"},
+		{name: "FunctionContext", flag: "-W", want: "4= func first() error {\n5. return nil\n6- }\n" +
+			"15= func (a) second() error {\n16- if true {\n17. return nil\n18- }\n19. return nil\n20- }\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "out.txt")
+			c, err := ConfigureWithArgs([]string{"gorep", tt.flag, "-o", outputPath, "return nil", path})
+			if err != nil {
+				t.Fatalf("ConfigureWithArgs failed: %v", err)
+			}
+			if got := c.Main(context.Background()); got != 0 {
+				t.Errorf("Expected exit code 0, got %d", got)
+			}
+			if content, _ := os.ReadFile(outputPath); string(content) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, content)
+			}
+		})
+	}
+}
+
+func TestShowFunctionOtherFiles(t *testing.T) {
+	c := newConfig(search.Regexp(regexp.MustCompile("x")), true, "", "", nil, 1)
+	c.showFunction = true
+	c.functionRegex = regexp.MustCompile(defaultFunctionRegex)
+	got := stripColors(c.matchToString("def f():\n    x = 1\n    return x\n\nx = 2\n", ""))
+	if want := "1= def f():\n2. x = 1\n3. return x\n5. x = 2\n"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if c.funcs != nil {
+		t.Error("Expected the declarations to be dropped once written")
+	}
+}
+
+func TestFunctionFlagValidation(t *testing.T) {
+	for _, args := range [][]string{
+		{"gorep", "-p", "-function-regex", "(", "test"},
+		{"gorep", "-W", "-vimgrep", "test"},
+		{"gorep", "-show-function", "-write", "-replace", "x", "test", "."},
+	} {
+		if _, err := ConfigureWithArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
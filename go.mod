@@ -2,6 +2,18 @@ module github.com/geofpwhite/gorep
 
 go 1.24.0
 
-require fortio.org/terminal v0.62.0
+require (
+	fortio.org/terminal v0.62.0
+	github.com/rivo/uniseg v0.4.7
+)
 
-require fortio.org/safecast v1.2.0 // indirect
+require (
+	fortio.org/log v1.18.3 // indirect
+	fortio.org/safecast v1.2.0 // indirect
+	fortio.org/struct2env v0.4.2 // indirect
+	github.com/jbuchbinder/gopnm v0.0.0-20220507095634-e31f54490ce0 // indirect
+	github.com/kortschak/goroutine v1.1.3 // indirect
+	golang.org/x/image v0.33.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+	golang.org/x/term v0.37.0 // indirect
+)
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"fortio.org/terminal/ansipixels/tcolor"
+)
+
+// groupColors are the colors of the capture groups with -highlight-groups, group n
+// taking the (n-1)th, modulo their number. The rest of the match stays GREEN.
+var groupColors = []string{
+	tcolor.Yellow.Foreground(),
+	tcolor.Cyan.Foreground(),
+	tcolor.Purple.Foreground(),
+	tcolor.BrightYellow.Foreground(),
+	tcolor.BrightCyan.Foreground(),
+	tcolor.BrightPurple.Foreground(),
+}
+
+// writeGroups writes line[from:to], part of the match s, in the color of the innermost
+// capture group covering each character of it.
+func writeGroups(b *strings.Builder, line string, from, to int, s lineSpan) {
+	// The colors can only change where a group starts or ends.
+	cuts := []int{from, to}
+	for _, bound := range s.match[2:] {
+		if bound -= s.start; bound > from && bound < to {
+			cuts = append(cuts, bound)
+		}
+	}
+	slices.Sort(cuts)
+	cuts = slices.Compact(cuts)
+	color := GREEN
+	for i, cut := range cuts[:len(cuts)-1] {
+		if c := groupColor(s, cut); c != color {
+			b.WriteString(c)
+			color = c
+		}
+		b.WriteString(line[cut:cuts[i+1]])
+	}
+}
+
+// groupColor returns the color of the character at offset i of the line of the match s.
+// Groups are numbered by their opening parenthesis, so the innermost one covering a
+// character is the last.
+func groupColor(s lineSpan, i int) string {
+	for g := len(s.match)/2 - 1; g > 0; g-- {
+		start, end := s.match[2*g], s.match[2*g+1]
+		if start >= 0 && start-s.start <= i && i < end-s.start {
+			return groupColors[(g-1)%len(groupColors)]
+		}
+	}
+	return GREEN
+}
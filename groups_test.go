@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestHighlightGroups(t *testing.T) {
+	yellow, cyan, purple := groupColors[0], groupColors[1], groupColors[2]
+	tests := []struct {
+		name      string
+		pattern   string
+		multiline bool
+		input     string
+		want      string
+	}{
+		{
+			name:    "Nested",
+			pattern: `(\w+)=((b)\w*|\w+)`,
+			input:   "key=value; a=bb",
+			want: RED + "1. " + WHITE + GREEN + yellow + "key" + GREEN + "=" + cyan + "value" + WHITE + "; " +
+				GREEN + yellow + "a" + GREEN + "=" + purple + "b" + cyan + "b" + WHITE + "\n",
+		},
+		{
+			name:    "Unmatched",
+			pattern: `a(x)?(b)`,
+			input:   "ab",
+			want:    RED + "1. " + WHITE + GREEN + "a" + cyan + "b" + WHITE + "\n",
+		},
+		{
+			name:      "Multiline",
+			pattern:   `(b\nc)(d)`,
+			multiline: true,
+			input:     "ab\ncd\n",
+			want: RED + "1-2. " + WHITE + "a" + GREEN + yellow + "b" + WHITE + "\n" +
+				RED + "2. " + WHITE + GREEN + yellow + "c" + cyan + "d" + WHITE + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConfig(search.Regexp(regexp.MustCompile(tt.pattern)), true, "", "", nil, 1)
+			c.highlightGroups = true
+			c.multiline = tt.multiline
+			if got := c.matchToString(tt.input, ""); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHighlightGroupsReplace(t *testing.T) {
+	if _, err := ConfigureWithArgs([]string{"gorep", "-highlight-groups", "-replace", "x", "a", "-text", "b"}); err == nil {
+		t.Error("Expected an error with -replace")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+// isIndexCommand tells whether args run "gorep index build" rather than a search.
+func isIndexCommand(args []string) bool {
+	return len(args) > 2 && args[1] == "index" && args[2] == "build"
+}
+
+// configureIndex reads the arguments of "gorep index build [flags] [DIR]", which builds
+// the index of DIR, the current directory by default, or brings it up to date.
+func configureIndex(args []string) (*config, error) {
+	fs := flag.NewFlagSet(args[0]+" index build", flag.ContinueOnError)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of files read concurrently")
+	var noMessages bool
+	fs.BoolVar(&noMessages, "s", false, "don't report files or directories that can't be read, nor fail because of them")
+	fs.BoolVar(&noMessages, "no-messages", false, "same as -s")
+	var ignore []string
+	var maxFileSize int64
+	addSkipFlags(fs, &ignore, &maxFileSize)
+	dirs, err := parseFlags(fs, args[3:])
+	if err != nil {
+		return nil, err
+	}
+
+	dir := "."
+	switch len(dirs) {
+	case 0:
+	case 1:
+		dir = dirs[0]
+	default:
+		return nil, errors.New("gorep index build takes a single directory")
+	}
+	if *workers < 1 {
+		*workers = 1
+	}
+	c := newConfig(nil, true, dir, "", nil, *workers)
+	c.indexing = true
+	c.noMessages = noMessages
+	c.ignore = ignore
+	c.maxFileSize = maxFileSize
+	return c, nil
+}
+
+// buildIndex builds the index of the directory given, or updates the one it already has by
+// reading the files that changed since.
+func (c *config) buildIndex(ctx context.Context) error {
+	dir := c.paths[0]
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("can't index %s: not a directory", dir)
+	}
+	ix, err := search.OpenIndex(dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("%v, building it again\n", err)
+		}
+		if ix, err = search.NewIndex(dir); err != nil {
+			return err
+		}
+	}
+	read, err := c.searcher().UpdateIndex(ctx, ix)
+	if err != nil {
+		return fmt.Errorf("can't index %s: %w", dir, err)
+	}
+	if err := ix.Save(); err != nil {
+		return fmt.Errorf("can't save the index: %w", err)
+	}
+	fmt.Printf("indexed %d files in %s (%d read)\n", ix.Len(), ix.Root(), read)
+	return nil
+}
+
+// loadIndex opens the index covering path: the one of the directory path is, or is in,
+// or else of the closest directory above it that has one.
+func loadIndex(path string) (*search.Index, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		ix, err := search.OpenIndex(dir)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return ix, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no index found for %s, build one with: gorep index build DIR", path)
+		}
+		dir = parent
+	}
+}
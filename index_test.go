@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestConfigureIndex(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "index", "build", "-ignore", "vendor", "-workers", "0", "src"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !c.indexing || !slices.Equal(c.paths, []string{"src"}) || c.workers != 1 || len(c.ignore) != 1 {
+		t.Errorf("Unexpected configuration %+v", c)
+	}
+	if c, _ := ConfigureWithArgs([]string{"gorep", "index", "build"}); c == nil || !slices.Equal(c.paths, []string{"."}) {
+		t.Error("Expected the current directory to be indexed by default")
+	}
+	if _, err := ConfigureWithArgs([]string{"gorep", "index", "build", "a", "b"}); err == nil {
+		t.Error("Expected an error with two directories")
+	}
+	if _, err := ConfigureWithArgs([]string{"gorep", "-index", "test"}); err == nil {
+		t.Error("Expected an error using -index without -f")
+	}
+	// Without "build", index is a pattern like any other.
+	if c, err := ConfigureWithArgs([]string{"gorep", "index", "some text"}); err != nil || c.indexing {
+		t.Errorf("Expected a search for index, got %+v (%v)", c, err)
+	}
+}
+
+func TestBuildIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("alpha\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("beta\n"), 0o644)
+
+	build := func() int {
+		t.Helper()
+		c, err := ConfigureWithArgs([]string{"gorep", "index", "build", tempDir})
+		if err != nil {
+			t.Fatalf("ConfigureWithArgs failed: %v", err)
+		}
+		return c.Main(context.Background())
+	}
+	if status := build(); status != 0 {
+		t.Fatalf("Expected exit code 0, got %d", status)
+	}
+	ix, err := search.OpenIndex(tempDir)
+	if err != nil || ix.Len() != 2 {
+		t.Fatalf("Expected an index of 2 files, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(tempDir, "c.txt"), []byte("gamma\n"), 0o644)
+	if status := build(); status != 0 {
+		t.Fatalf("Expected exit code 0, got %d", status)
+	}
+	if ix, _ := search.OpenIndex(tempDir); ix.Len() != 3 {
+		t.Errorf("Expected the index to be updated, got %d files", ix.Len())
+	}
+
+	// An index that can't be read is built again.
+	os.WriteFile(filepath.Join(tempDir, search.IndexFile), []byte("garbage"), 0o644)
+	if status := build(); status != 0 {
+		t.Fatalf("Expected exit code 0, got %d", status)
+	}
+	if ix, err := search.OpenIndex(tempDir); err != nil || ix.Len() != 3 {
+		t.Errorf("Expected the index to be built again, got %v", err)
+	}
+
+	c, _ := ConfigureWithArgs([]string{"gorep", "index", "build", filepath.Join(tempDir, "a.txt")})
+	if status := c.Main(context.Background()); status != 2 {
+		t.Errorf("Expected exit code 2 indexing a file, got %d", status)
+	}
+}
+
+func TestSearchWithIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("alpha\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("beta\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "sub", "c.txt"), []byte("gamma\n"), 0o644)
+
+	c, _ := ConfigureWithArgs([]string{"gorep", "-index", "-f", tempDir, "alpha"})
+	if status := c.Main(context.Background()); status != 2 {
+		t.Errorf("Expected exit code 2 without an index, got %d", status)
+	}
+
+	c, _ = ConfigureWithArgs([]string{"gorep", "index", "build", tempDir})
+	c.Main(context.Background())
+	os.WriteFile(filepath.Join(tempDir, "sub", "c.txt"), []byte("gamma beta\n"), 0o644)
+	os.Chtimes(filepath.Join(tempDir, "sub", "c.txt"), time.Now(), time.Now().Add(time.Minute))
+
+	// The index of the directory above is found, and the changed file searched anyway.
+	c, _ = ConfigureWithArgs([]string{"gorep", "-index", "-stats", "-f", filepath.Join(tempDir, "sub"), "beta"})
+	if status := c.Main(context.Background()); status != 0 {
+		t.Errorf("Expected exit code 0, got %d", status)
+	}
+	if c.matchedLines != 2 {
+		t.Errorf("Expected 2 matching lines, got %d", c.matchedLines)
+	}
+	stats := c.statsSummary(0)
+	if !strings.Contains(stats, "0 files pruned by the index") {
+		t.Errorf("Expected the pruned files in the stats, got %q", stats)
+	}
+
+	c, _ = ConfigureWithArgs([]string{"gorep", "-index", "-f", tempDir, "gamma"})
+	if status := c.Main(context.Background()); status != 0 {
+		t.Errorf("Expected exit code 0, got %d", status)
+	}
+	if st := c.searcher().Stats(); st.FilesPruned != 2 || st.FilesSearched != 1 {
+		t.Errorf("Expected a.txt and b.txt to be pruned, got %+v", st)
+	}
+}
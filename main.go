@@ -1,79 +1,385 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"io/fs"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
-	"sync"
-	"unicode/utf8"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"fortio.org/terminal/ansipixels/tcolor"
+	"github.com/geofpwhite/gorep/search"
+	"github.com/rivo/uniseg"
 )
 
 type config struct {
-	trim       bool
-	file       string
+	trim bool
+	// paths are the files and directories to search, given with -f or as arguments.
+	paths      []string
 	outputPath string
-	re         *regexp.Regexp
-	args       []string
-	workers    int
+	matcher    search.Matcher
+	// args holds the pattern, followed with -text by the text to search.
+	args    []string
+	text    bool
+	workers int
+	// filesFrom is the -files-from list the paths were read from, if any.
+	filesFrom string
+	null      bool
+	// listFiles prints the files that would be searched, for -files, instead of searching.
+	listFiles bool
+	debug     bool
+
+	replace   string
+	replacing bool
+	write     bool
+	dryRun    bool
+
+	column     bool
+	byteOffset bool
+	vimgrep    bool
+
+	maxCount   int
+	maxTotal   int
+	noMessages bool
+	quiet      bool
+	// matchedLines counts the matching lines found, or the lines changed by -write.
+	matchedLines int
+	// failed is set when an error should make gorep exit with status 2.
+	failed atomic.Bool
+
+	ignore      []string
+	maxFileSize int64
+
+	showStats bool
+
+	// maxColumns is the display width above which lines are omitted, or with
+	// maxColumnsPreview cut down to what's around their matches.
+	maxColumns        int
+	maxColumnsPreview bool
+
+	multiline bool
+	// highlightGroups colors each capture group of the matches differently.
+	highlightGroups bool
+	// scope restricts the matches to some regions of Go source, see -in.
+	scope search.Scope
+
+	showFunction    bool
+	functionContext bool
+	functionRegex   *regexp.Regexp
+	// funcs holds the declarations of the file being written, with -show-function or
+	// -function-context.
+	funcs *functions
+
+	outputMode   string
+	outputFailed atomic.Bool
+	// exclude lists absolute paths directory searches must leave out: gorep's own output.
+	exclude []string
+	// engine runs the search, see searcher.
+	engine *search.Searcher
+
+	watching bool
+	// watched counts the matching lines of each file while watching.
+	watched map[string]int
+
+	tui bool
+	// matcherOptions builds the matchers of the patterns typed in -tui.
+	matcherOptions search.MatcherOptions
+
+	// indexing runs "gorep index build" instead of a search.
+	indexing bool
+	useIndex bool
+	index    *search.Index
 }
 
-func newConfig(re *regexp.Regexp, trim bool, file string, outputPath string, args []string, workers int) *config {
+func newConfig(m search.Matcher, trim bool, file string, outputPath string, args []string, workers int) *config {
+	var paths []string
+	if file != "" {
+		paths = []string{file}
+	}
 	return &config{
 		trim:       trim,
-		file:       file,
+		paths:      paths,
 		outputPath: outputPath,
-		re:         re,
+		matcher:    m,
 		args:       args,
 		workers:    workers,
+		outputMode: outputFail,
 	}
 }
 
+// Configure reads the command line, after the defaults of the config file and
+// GOREP_OPTS, see withDefaults.
 func Configure() (*config, error) {
-	return ConfigureWithArgs(os.Args)
+	args, err := withDefaults(os.Args)
+	if err != nil {
+		return nil, err
+	}
+	return ConfigureWithArgs(args)
 }
 
 func ConfigureWithArgs(args []string) (*config, error) {
 	if len(args) < 2 {
 		return nil, errors.New("gorep needs a pattern to match")
 	}
+	if isIndexCommand(args) {
+		return configureIndex(args)
+	}
 
 	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
 	noTrim := fs.Bool("no-trim", false,
 		"disable trimming leading indentation in each line when printed")
-	fileFlag := fs.String("f", "", "take input from a file or directory")
+	var paths []string
+	fs.Func("f", "search this file or directory, like the arguments after the pattern (can be repeated)", func(s string) error {
+		paths = append(paths, s)
+		return nil
+	})
+	text := fs.Bool("text", false, "search the arguments after the pattern, joined with spaces, rather than files")
+	filesFrom := fs.String("files-from", "", "search the paths listed in this file, or stdin for -, one per line or NUL-separated")
+	null := fs.Bool("null", false, "follow file names with a NUL byte in the output, instead of what usually comes after them")
 	outputFile := fs.String("o", "", "save the matches to a file")
+	outputMode := fs.String("output-mode", outputFail,
+		"what to do when the -o file already exists: fail, overwrite or append")
 	workers := fs.Int("workers", runtime.NumCPU(), "number of concurrent workers for directory search")
-
-	if err := fs.Parse(args[1:]); err != nil {
+	replace := fs.String("replace", "", "replace each match with this template ($1, ${name} expand capture groups)")
+	write := fs.Bool("write", false, "apply -replace to the files searched, printing a diff of each change")
+	dryRun := fs.Bool("dry-run", false, "like -write but only print the diff, leaving files untouched")
+	column := fs.Bool("column", false, "show the 1-based column (in characters) of the first match on each line")
+	byteOffset := fs.Bool("byte-offset", false, "show the byte offset of the first match on each line from the start of the input")
+	var maxCount, maxTotal int
+	fs.IntVar(&maxCount, "m", 0, "stop reading a file after this many matching lines (0 means no limit)")
+	fs.IntVar(&maxCount, "max-count", 0, "same as -m")
+	fs.IntVar(&maxTotal, "max-total", 0, "stop the whole search after this many matching lines (0 means no limit)")
+	var noMessages bool
+	fs.BoolVar(&noMessages, "s", false, "don't report files or directories that can't be read, nor fail because of them")
+	fs.BoolVar(&noMessages, "no-messages", false, "same as -s")
+	var quiet bool
+	fs.BoolVar(&quiet, "q", false, "print nothing, stop at the first match and exit with status 0 if there was one")
+	fs.BoolVar(&quiet, "quiet", false, "same as -q")
+	var ignore []string
+	var maxFileSize int64
+	addSkipFlags(fs, &ignore, &maxFileSize)
+	var multiline bool
+	fs.BoolVar(&multiline, "U", false, "multiline mode: match the pattern against the whole input so matches can span lines")
+	fs.BoolVar(&multiline, "multiline", false, "same as -U")
+	highlightGroups := fs.Bool("highlight-groups", false, "color each capture group of the matches differently, nested ones included")
+	var showFunction, functionContext bool
+	fs.BoolVar(&showFunction, "p", false, "show the header of the function or type declaration enclosing the matches")
+	fs.BoolVar(&showFunction, "show-function", false, "same as -p")
+	fs.BoolVar(&functionContext, "W", false, "show the whole function or type declaration enclosing the matches")
+	fs.BoolVar(&functionContext, "function-context", false, "same as -W")
+	functionRegex := fs.String("function-regex", defaultFunctionRegex,
+		"lines starting a declaration in files other than Go ones, for -p and -W")
+	in := fs.String("in", "", "only match in these regions of Go source: comments, strings, identifiers or code (the rest)")
+	var fixed, ignoreCase, word bool
+	fs.BoolVar(&fixed, "F", false, "treat the pattern as a literal string, or a list of them separated by newlines")
+	fs.BoolVar(&fixed, "fixed-strings", false, "same as -F")
+	fs.BoolVar(&ignoreCase, "ignore-case", false, "ignore case")
+	fs.BoolVar(&word, "w", false, "only match whole words")
+	fs.BoolVar(&word, "word-regexp", false, "same as -w")
+	var patterns []string
+	fs.Func("e", "search for this pattern, instead of the first argument (can be repeated to match any of them)", func(s string) error {
+		patterns = append(patterns, s)
+		return nil
+	})
+	showStats := fs.Bool("stats", false, "print statistics about the search once it's done")
+	maxColumns := fs.Int("max-columns", 0, "omit lines wider than this many columns, counting what's printed of them (0 means no limit)")
+	maxColumnsPreview := fs.Bool("max-columns-preview", false, "show what's around each match of the lines -max-columns omits")
+	vimgrep := fs.Bool("vimgrep", false, "print every match as an uncolored path:line:column:text line, for editor quickfix lists")
+	watch := fs.Bool("watch", false, "keep running after searching the directories given, searching files again as they change")
+	useIndex := fs.Bool("index", false, "skip the files that can't match according to the index built with gorep index build")
+	// Handled by withDefaults, defined so that it's accepted and listed.
+	fs.Bool("no-config", false, "don't read the config file")
+	files := fs.Bool("files", false, "print the files that would be searched, without any pattern, instead of searching them")
+	debug := fs.Bool("debug", false, "report every file or directory skipped and why, even those ignored on purpose or with -s")
+	var tui bool
+	fs.BoolVar(&tui, "i", false, "search the files and directories given, or the current one, interactively, updating results as the pattern is typed")
+	fs.BoolVar(&tui, "tui", false, "same as -i")
+
+	parsedArgs, err := parseFlags(fs, args[1:])
+	if err != nil {
 		return nil, err
 	}
 
-	parsedArgs := fs.Args()
-	if len(parsedArgs) == 0 {
+	if *files {
+		// There is no pattern, all the arguments are paths.
+		if len(patterns) > 0 || *text {
+			return nil, errors.New("-files takes no pattern, nor -text")
+		}
+		paths = append(paths, parsedArgs...)
+		parsedArgs = nil
+	} else if len(patterns) > 0 {
+		// All the arguments are paths, or text, to search: keep the pattern in front as usual.
+		parsedArgs = append([]string{strings.Join(patterns, "\n")}, parsedArgs...)
+	} else if len(parsedArgs) == 0 && !tui {
 		return nil, errors.New("pattern argument required")
+	} else if len(parsedArgs) > 0 {
+		patterns = []string{parsedArgs[0]}
+	}
+	if fixed {
+		// Like grep, -F takes a list of strings separated by newlines.
+		patterns = strings.Split(strings.Join(patterns, "\n"), "\n")
 	}
 
-	re, err := regexp.Compile(parsedArgs[0])
-	if err != nil {
-		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	matcherOptions := search.MatcherOptions{
+		Fixed:      fixed,
+		IgnoreCase: ignoreCase,
+		Word:       word,
+		Multiline:  multiline,
+	}
+	var m search.Matcher
+	if len(patterns) > 0 {
+		m, err = search.NewMatcher(patterns, matcherOptions)
+		// -tui shows what's wrong with the pattern, and lets it be fixed.
+		if err != nil && !tui {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
 	}
 
 	if *workers < 1 {
 		*workers = 1
 	}
 
-	return newConfig(re, !*noTrim, *fileFlag, *outputFile, parsedArgs, *workers), nil
+	if *text {
+		if len(paths) > 0 || *filesFrom != "" {
+			return nil, errors.New("-text can't be used with -f or -files-from")
+		}
+		if len(parsedArgs) < 2 {
+			return nil, errors.New("-text needs text to search after the pattern")
+		}
+	} else if len(parsedArgs) > 1 {
+		paths = append(paths, parsedArgs[1:]...)
+		parsedArgs = parsedArgs[:1]
+	}
+
+	if *filesFrom != "" {
+		list, err := readFilesFrom(*filesFrom)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, list...)
+	}
+
+	c := newConfig(m, !*noTrim, "", *outputFile, parsedArgs, *workers)
+	c.paths = paths
+	c.text = *text
+	c.filesFrom = *filesFrom
+	c.null = *null
+	c.listFiles = *files
+	c.debug = *debug
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "replace" {
+			c.replacing = true
+		}
+	})
+	c.replace = *replace
+	c.write = *write
+	c.dryRun = *dryRun
+	c.column = *column
+	c.byteOffset = *byteOffset
+	c.vimgrep = *vimgrep
+	c.maxCount = maxCount
+	c.maxTotal = maxTotal
+	c.noMessages = noMessages
+	c.quiet = quiet
+	c.ignore = ignore
+	c.maxFileSize = maxFileSize
+	c.showStats = *showStats
+	c.maxColumns = *maxColumns
+	c.maxColumnsPreview = *maxColumnsPreview
+	c.multiline = multiline
+	c.highlightGroups = *highlightGroups
+	c.watching = *watch
+	c.tui = tui
+	c.useIndex = *useIndex
+	c.matcherOptions = matcherOptions
+	if c.multiline && c.replacing {
+		return nil, errors.New("-replace can't be used with -U")
+	}
+	if c.highlightGroups && c.replacing {
+		return nil, errors.New("-highlight-groups can't be used with -replace")
+	}
+	switch *in {
+	case "":
+	case "comments":
+		c.scope = search.ScopeComments
+	case "strings":
+		c.scope = search.ScopeStrings
+	case "identifiers":
+		c.scope = search.ScopeIdentifiers
+	case "code":
+		c.scope = search.ScopeCode
+	default:
+		return nil, fmt.Errorf("invalid -in %q, must be comments, strings, identifiers or code", *in)
+	}
+	c.showFunction = showFunction
+	c.functionContext = functionContext
+	if c.showsFunctions() {
+		if c.functionRegex, err = regexp.Compile(*functionRegex); err != nil {
+			return nil, fmt.Errorf("invalid -function-regex: %w", err)
+		}
+		if c.vimgrep || c.rewriting() || c.tui || c.listFiles {
+			return nil, errors.New("-p and -W can't be used with -vimgrep, -write, -dry-run, -tui or -files")
+		}
+	}
+	if c.scope != search.ScopeAll && (c.write || c.dryRun) {
+		return nil, errors.New("-in can't be used with -write or -dry-run")
+	}
+	switch *outputMode {
+	case outputFail, outputOverwrite, outputAppend:
+		c.outputMode = *outputMode
+	default:
+		return nil, fmt.Errorf("invalid -output-mode %q, must be fail, overwrite or append", *outputMode)
+	}
+	if (c.write || c.dryRun) && !c.replacing {
+		return nil, errors.New("-write and -dry-run need a -replace template")
+	}
+	if c.rewriting() && c.quiet {
+		return nil, errors.New("-q can't be used with -write or -dry-run")
+	}
+	if c.rewriting() && (c.maxCount > 0 || c.maxTotal > 0) {
+		// Every match of a file is replaced, and every file matching rewritten.
+		return nil, errors.New("-m and -max-total can't be used with -write or -dry-run")
+	}
+	if (c.write || c.dryRun) && len(c.paths) == 0 {
+		return nil, errors.New("-write and -dry-run need files or directories to rewrite")
+	}
+	if c.watching {
+		switch {
+		case len(c.paths) == 0:
+			return nil, errors.New("-watch needs directories to watch")
+		case c.rewriting() || c.quiet || c.outputPath != "":
+			return nil, errors.New("-watch can't be used with -write, -dry-run, -q or -o")
+		}
+	}
+	if c.listFiles && (c.replacing || c.watching || c.tui || c.useIndex) {
+		return nil, errors.New("-files can't be used with -replace, -watch, -tui or -index")
+	}
+	if c.maxColumnsPreview && c.maxColumns <= 0 {
+		return nil, errors.New("-max-columns-preview needs -max-columns")
+	}
+	if c.useIndex && len(c.paths) == 0 && !c.tui {
+		return nil, errors.New("-index needs files or directories to search")
+	}
+	if c.tui {
+		switch {
+		case c.text:
+			return nil, errors.New("-tui searches files, it can't be used with -text")
+		case c.rewriting() || c.quiet || c.outputPath != "" || c.watching || c.vimgrep || c.showStats:
+			return nil, errors.New("-tui can't be used with -write, -dry-run, -q, -o, -watch, -vimgrep or -stats")
+		}
+	}
+	return c, nil
 }
 
 var (
@@ -83,256 +389,477 @@ var (
 	BLUE  = tcolor.Blue.Foreground()
 )
 
-type fileJob struct {
-	path string
-	name string
-}
-
-type matchResult struct {
-	filename string
-	output   string
-	hasMatch bool
-}
-
 func (c *config) Main(ctx context.Context) int {
-	var opf *os.File
-	if c.outputPath != "" {
-		_, err := os.Stat(c.outputPath)
-		if err == nil {
-			log.Println("output file already exists")
-			return 1
-		}
-		opf, err = os.Create(c.outputPath)
-		if err != nil {
-			log.Println("output file couldn't be created")
-			return 1
+	if c.indexing {
+		if err := c.buildIndex(ctx); err != nil {
+			log.Println(err)
+			return 2
 		}
-		defer opf.Close()
+		if c.failed.Load() {
+			return 2
+		}
+		return 0
 	}
-
-	var str string
-	if len(c.args) > 1 {
-		str = strings.Join(c.args[1:], " ")
+	start := time.Now()
+	out, err := c.openOutput()
+	if err != nil {
+		log.Println(err)
+		return 2
 	}
+	c.engine = search.New(c.searchOptions())
+	err = c.run(ctx, out.file())
+	if out != nil {
+		// Only a complete run replaces what the output file held before.
+		if err == nil && ctx.Err() == nil && !c.outputFailed.Load() {
+			if cerr := out.commit(); cerr != nil {
+				err = fmt.Errorf("output file couldn't be saved: %w", cerr)
+			}
+		} else {
+			out.discard()
+		}
+	}
+	if c.showStats {
+		fmt.Print(c.statsSummary(time.Since(start)))
+	}
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+	return c.exitStatus()
+}
 
-	switch {
-	case c.file != "":
-		info, err := os.Stat(c.file)
+// run searches the input selected by the configuration, writing matches to stdout and
+// opf. Problems with individual files found in a directory are recorded rather than
+// returned, see skip.
+func (c *config) run(ctx context.Context, opf *os.File) error {
+	if c.useIndex {
+		// A single index is used, the one covering the first path.
+		root := "."
+		if len(c.paths) > 0 {
+			root = c.paths[0]
+		}
+		ix, err := loadIndex(root)
 		if err != nil {
-			log.Println("can't open given file or directory")
-			return 1
+			return err
 		}
-		if info.IsDir() {
-			absPath, err := filepath.Abs(c.file)
-			if err != nil {
-				log.Printf("failed to get absolute path: %v\n", err)
-				return 1
-			}
-			if err := c.searchDirectory(ctx, absPath, opf); err != nil {
-				log.Printf("error searching directory: %v\n", err)
-				return 1
-			}
-			return 0
+		c.index = ix
+		c.engine = search.New(c.searchOptions())
+	}
+	switch {
+	case c.listFiles:
+		return c.printFiles(ctx, opf)
+	case c.tui:
+		pattern := ""
+		if len(c.args) > 0 {
+			pattern = c.args[0]
 		}
-		content, err := os.ReadFile(c.file)
+		return c.runTUI(ctx, pattern)
+	case len(c.paths) > 0 || c.filesFrom != "":
+		// An empty -files-from list searches nothing, rather than stdin.
+		return c.searchPaths(ctx, opf)
+	case len(c.args) < 2 && c.showsFunctions():
+		// The declarations can only be found in the whole input.
+		content, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			log.Println("can't open given file")
-			return 1
+			return fmt.Errorf("can't read standard input: %w", err)
 		}
-		str = string(content)
+		c.match(string(content), "", opf)
+		return nil
 	case len(c.args) < 2:
-		scanner := bufio.NewScanner(os.Stdin)
-		var builder strings.Builder
-		for scanner.Scan() {
-			builder.Write(scanner.Bytes())
-			builder.WriteByte('\n')
-		}
-		if err := scanner.Err(); err != nil {
-			log.Println("invalid input")
-			return 1
+		// Each match is printed as soon as its line is read, for input that keeps coming.
+		for m, err := range c.searcher().SearchReader(ctx, c.inputName(), os.Stdin) {
+			if err != nil {
+				return fmt.Errorf("can't read standard input: %w", err)
+			}
+			var printBuilder strings.Builder
+			c.writeMatch(&printBuilder, m)
+			c.emit(printBuilder.String(), opf)
 		}
-		str = builder.String()
+		return nil
 	}
 
-	c.match(str, "", opf)
-	return 0
+	c.match(strings.Join(c.args[1:], " "), "", opf)
+	return nil
 }
 
-func (c *config) searchDirectory(ctx context.Context, path string, outputFile *os.File) error {
-	jobs := make(chan fileJob, c.workers*2)
-	results := make(chan matchResult, c.workers*2)
-
-	var wg sync.WaitGroup
-
-	// Start worker pool
-	for i := 0; i < c.workers; i++ {
-		wg.Add(1)
-		go c.worker(ctx, jobs, results, &wg)
-	}
-
-	// Start result collector
-	done := make(chan struct{})
-	var outputMutex sync.Mutex
-	go func() {
-		for result := range results {
-			if result.hasMatch {
-				outputMutex.Lock()
-				fmt.Print(result.output)
-				if outputFile != nil {
-					cleanOutput := result.output
-					for _, toRemove := range []string{GREEN, RED, BLUE, WHITE} {
-						cleanOutput = strings.ReplaceAll(cleanOutput, toRemove, "")
-					}
-					outputFile.WriteString(cleanOutput)
-				}
-				outputMutex.Unlock()
-			}
-		}
-		close(done)
-	}()
+// exitStatus follows grep: 0 when something matched, 1 when nothing did and 2 when an
+// error occurred along the way. With -q a match wins over errors.
+func (c *config) exitStatus() int {
+	switch {
+	case c.quiet && c.matchedLines > 0:
+		return 0
+	case c.failed.Load():
+		return 2
+	case c.matchedLines > 0:
+		return 0
+	default:
+		return 1
+	}
+}
 
-	// Walk directory and send jobs
-	go func() {
-		defer close(jobs)
-		filepath.WalkDir(path, func(filePath string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return nil
-			}
+// searcher returns the Searcher running the configured search, set up by Main or on
+// first use.
+func (c *config) searcher() *search.Searcher {
+	if c.engine == nil {
+		c.engine = search.New(c.searchOptions())
+	}
+	return c.engine
+}
 
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
+func (c *config) searchOptions() search.Options {
+	opts := search.Options{
+		Matcher:     c.matcher,
+		Workers:     c.workers,
+		Multiline:   c.multiline,
+		Scope:       c.scope,
+		MaxCount:    c.maxCount,
+		MaxTotal:    c.maxTotal,
+		Submatches:  c.replacing || c.highlightGroups,
+		Ignore:      c.ignore,
+		MaxFileSize: c.maxFileSize,
+		Exclude:     c.exclude,
+		Index:       c.index,
+		OnSkip:      c.skip,
+	}
+	if c.quiet {
+		// Whether there is a match is all that matters.
+		opts.MaxTotal = 1
+	}
+	if c.rewriting() {
+		// A single match tells a file needs rewriting, and all of it is rewritten.
+		opts.MaxCount, opts.MaxTotal = 1, 0
+	}
+	return opts
+}
 
-			if d.IsDir() {
-				return nil
+// searchPaths searches the files and directories of c.paths in a single run, those that
+// can't be opened being reported, and then keeps watching the directories with -watch.
+// Matches come after the name of their file, unless a single file is searched.
+func (c *config) searchPaths(ctx context.Context, opf *os.File) error {
+	var roots, dirs []string
+	for _, path := range c.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if len(c.paths) == 1 {
+				return fmt.Errorf("can't open %s: %w", path, err)
 			}
+			log.Printf("can't open %s: %v\n", path, err)
+			c.failed.Store(true)
+			continue
+		}
+		if !info.IsDir() && c.watching {
+			return fmt.Errorf("-watch only watches directories, %s isn't one", path)
+		}
+		if path, err = filepath.Abs(path); err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		roots = append(roots, path)
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+	// A file reachable from several roots would be searched, or rewritten, once for each.
+	roots, dirs = pruneRoots(roots, dirs), pruneRoots(dirs, dirs)
 
-			jobs <- fileJob{path: filePath, name: d.Name()}
-			return nil
-		})
-	}()
+	if c.watching {
+		c.watched = make(map[string]int)
+	}
+	headers := len(c.paths) > 1 || len(dirs) > 0
+	if err := c.searchFiles(ctx, roots, headers, opf); err != nil {
+		return fmt.Errorf("error searching: %w", err)
+	}
+	if summary := c.skipSummary(); summary != "" && !c.noMessages {
+		log.Println(summary)
+	}
+	if c.watching {
+		return c.watch(ctx, dirs)
+	}
+	return nil
+}
 
-	wg.Wait()
-	close(results)
-	<-done
+// pruneRoots returns the absolute paths roots without the duplicates, nor those lying
+// under one of the directories dirs.
+func pruneRoots(roots, dirs []string) []string {
+	var kept []string
+	for _, root := range roots {
+		if slices.Contains(kept, root) || slices.ContainsFunc(dirs, func(dir string) bool { return under(root, dir) }) {
+			continue
+		}
+		kept = append(kept, root)
+	}
+	return kept
+}
 
-	return nil
+// under tells whether path lies under the directory dir, both being clean.
+func under(path, dir string) bool {
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
 }
 
-func (c *config) worker(ctx context.Context, jobs <-chan fileJob, results chan<- matchResult, wg *sync.WaitGroup) {
-	defer wg.Done()
+// searchDirectory searches the files under path, printing the matches of each one
+// after its name.
+func (c *config) searchDirectory(ctx context.Context, path string, outputFile *os.File) error {
+	return c.searchFiles(ctx, []string{path}, true, outputFile)
+}
 
-	for job := range jobs {
-		select {
-		case <-ctx.Done():
-			return
-		default:
+// searchFiles searches the roots, files or directories, printing the matches of each
+// file at once, after its name if headers is set. With -write or -dry-run the files
+// holding matches are rewritten instead.
+func (c *config) searchFiles(ctx context.Context, roots []string, headers bool, outputFile *os.File) error {
+	var printBuilder strings.Builder
+	current := ""
+	for m, err := range c.searcher().Search(ctx, roots...) {
+		if err != nil {
+			return err
 		}
-
-		content, err := os.ReadFile(job.path)
-		if err != nil || !utf8.Valid(content) {
-			continue
+		if m.Path != current {
+			c.finishFunctions(&printBuilder)
+			c.emit(printBuilder.String(), outputFile)
+			printBuilder.Reset()
+			current = m.Path
+			if c.rewriting() {
+				c.emit(c.rewriteFile(m.Path), outputFile)
+				continue
+			}
+			if headers && !c.vimgrep {
+				printBuilder.WriteString(c.fileName(m.Path) + "\n")
+			}
+			if c.showsFunctions() {
+				c.readFunctions(m.Path)
+			}
 		}
-
-		output := c.matchToString(string(content), fmt.Sprintf("%s%s: \n", BLUE, job.name))
-		results <- matchResult{
-			filename: job.name,
-			output:   output,
-			hasMatch: len(output) > 0,
+		if c.watched != nil {
+			c.watched[m.Path]++
 		}
+		c.writeMatch(&printBuilder, m)
 	}
+	c.finishFunctions(&printBuilder)
+	c.emit(printBuilder.String(), outputFile)
+	return nil
 }
 
 func (c *config) match(str string, preString string, output *os.File) {
-	result := c.matchToString(str, preString)
-	if len(result) > 0 {
+	if c.vimgrep {
+		c.emit(c.vimgrepToString(str, c.inputName()), output)
+		return
+	}
+	c.emit(c.matchToString(str, preString), output)
+}
+
+// inputName is the name reported for matches outside of directory searches.
+func (c *config) inputName() string {
+	if len(c.paths) == 1 {
+		return c.paths[0]
+	}
+	return "(standard input)"
+}
+
+// emit prints result and saves an uncolored copy of it to output, if any.
+// Nothing is printed with -q.
+func (c *config) emit(result string, output *os.File) {
+	if len(result) > 0 && !c.quiet {
 		fmt.Print(result)
 		if output != nil {
-			cleanOutput := result
-			for _, toRemove := range []string{GREEN, RED, BLUE, WHITE} {
-				cleanOutput = strings.ReplaceAll(cleanOutput, toRemove, "")
-			}
-			if _, err := output.WriteString(cleanOutput); err != nil {
+			if _, err := output.WriteString(stripColors(result)); err != nil {
 				log.Println("couldn't write output")
+				c.failed.Store(true)
+				c.outputFailed.Store(true)
 			}
 		}
 	}
 }
 
+// stripColors removes the color codes gorep adds to its output.
+func stripColors(s string) string {
+	for _, toRemove := range append([]string{GREEN, RED, BLUE, WHITE}, groupColors...) {
+		s = strings.ReplaceAll(s, toRemove, "")
+	}
+	return s
+}
+
+// writeMatch renders m in the selected format.
+func (c *config) writeMatch(b *strings.Builder, m search.Match) {
+	switch {
+	case c.vimgrep:
+		c.writeVimgrep(b, m)
+	case c.funcs != nil:
+		c.funcs.writeMatch(c, b, m)
+	default:
+		c.writeLines(b, m)
+	}
+}
+
+// matchToString renders the matches in str, preceded by preString if there are any.
 func (c *config) matchToString(str string, preString string) string {
+	matches := c.searcher().Find(c.inputName(), str)
+	if len(matches) == 0 {
+		return ""
+	}
 	var printBuilder strings.Builder
-	lineNum := 0
-	matchCount := 0
-
-	for line := range strings.Lines(str) {
-		lineNum++
+	printBuilder.WriteString(preString)
+	if c.showsFunctions() {
+		c.funcs = newFunctions(c.inputName(), str, c.functionRegex)
+	}
+	for _, m := range matches {
+		c.writeMatch(&printBuilder, m)
+	}
+	c.finishFunctions(&printBuilder)
+	return printBuilder.String()
+}
 
-		// Only run regex once, get indices
-		indices := c.re.FindAllStringIndex(line, -1)
-		if len(indices) == 0 {
-			continue
+// writeLines writes the lines of m, numbered, with the matches highlighted. The first
+// line is labeled with the range of lines m covers when there are several ("3-5. "),
+// and with the column and byte offset of the first match when asked for ("12:5@1234. ").
+func (c *config) writeLines(b *strings.Builder, m search.Match) {
+	c.matchedLines++
+	start := 0
+	for n := m.Line; n <= m.EndLine; n++ {
+		end := len(m.Text)
+		if i := strings.IndexByte(m.Text[start:], '\n'); i >= 0 {
+			end = start + i
 		}
 
-		matchCount++
+		b.WriteString(RED)
+		fmt.Fprintf(b, "%d", n)
+		if n == m.Line {
+			if m.EndLine > m.Line {
+				fmt.Fprintf(b, "-%d", m.EndLine)
+			}
+			if c.column {
+				fmt.Fprintf(b, ":%d", m.Column)
+			}
+			if c.byteOffset {
+				fmt.Fprintf(b, "@%d", m.Offset+int64(m.Spans[0][0]))
+			}
+		}
+		b.WriteString(". ")
+		b.WriteString(WHITE)
 
-		// Build line number prefix
-		printBuilder.WriteString(RED)
-		fmt.Fprintf(&printBuilder, "%d. ", lineNum)
-		printBuilder.WriteString(WHITE)
+		c.writeHighlighted(b, m, start, end, n == m.Line, n == m.EndLine)
+		b.WriteByte('\n')
+		start = end + 1
+	}
+}
 
-		// Build line with highlighted matches
-		curI := 0
-		for j, idx := range indices {
-			start, end := idx[0], idx[1]
+// writeHighlighted writes the line of m.Text between start and end, highlighting the
+// parts of it covered by matches, or showing their replacement with -replace.
+func (c *config) writeHighlighted(b *strings.Builder, m search.Match, start, end int, first, last bool) {
+	line := strings.TrimSuffix(m.Text[start:end], "\r")
+	var spans []lineSpan
+	for _, match := range m.Spans {
+		from, to := max(match[0], start), min(match[1], start+len(line))
+		if from < to || (match[0] == match[1] && match[0] >= start && match[0] <= start+len(line)) {
+			spans = append(spans, lineSpan{from - start, to - start, match, start})
+		}
+	}
 
-			// Pre-match text
-			pre := line[curI:start]
-			if c.trim && j == 0 {
-				pre = strings.TrimLeft(pre, "\t ")
-			}
-			printBuilder.WriteString(pre)
-
-			// Match text (highlighted)
-			printBuilder.WriteString(GREEN)
-			printBuilder.WriteString(line[start:end])
-			printBuilder.WriteString(WHITE)
-
-			curI = end
-
-			// Post-match text (on last match)
-			if j == len(indices)-1 {
-				post := line[end:]
-				if c.trim {
-					post = strings.TrimRight(post, "\t\n ")
-				}
-				printBuilder.WriteString(post)
-			}
+	head, tail := 0, len(line)
+	if c.trim {
+		head = len(line) - len(strings.TrimLeft(line, "\t "))
+		tail = max(len(strings.TrimRight(line, "\t ")), head)
+		// Only what's around the matches of a single line is trimmed, but the lines after
+		// the first of a multiline match usually start within it, and their indentation
+		// is just as much noise.
+		if first && len(spans) > 0 {
+			head = min(head, spans[0].from)
+		}
+		if last && len(spans) > 0 {
+			tail = max(tail, spans[len(spans)-1].to)
 		}
+	}
 
-		printBuilder.WriteByte('\n')
+	if c.maxColumns > 0 && uniseg.StringWidth(line[head:tail]) > c.maxColumns {
+		c.writeLongLine(b, m, line, spans, head, tail)
+		return
 	}
+	c.writeSpans(b, m, line, spans, head, tail)
+}
 
-	if matchCount == 0 {
-		return ""
+// lineSpan is a match, or the part of it, found in a line of a Match, from and to being
+// relative to the line.
+type lineSpan struct {
+	from, to int
+	match    []int
+	// start is the offset of the line in the Text of the Match.
+	start int
+}
+
+// writeSpans writes line[head:tail], highlighting the parts of it covered by spans.
+func (c *config) writeSpans(b *strings.Builder, m search.Match, line string, spans []lineSpan, head, tail int) {
+	cur := head
+	for _, s := range spans {
+		from, to := min(max(s.from, cur), tail), min(max(s.to, cur), tail)
+		b.WriteString(line[cur:from])
+		b.WriteString(GREEN)
+		switch {
+		case c.replacing:
+			b.Write(c.matcher.Expand(nil, c.replace, m.Text, s.match))
+		case c.highlightGroups:
+			writeGroups(b, line, from, to, s)
+		default:
+			b.WriteString(line[from:to])
+		}
+		b.WriteString(WHITE)
+		cur = to
 	}
+	b.WriteString(line[cur:tail])
+}
 
-	// Prepend filename if provided
-	if preString != "" {
-		return preString + printBuilder.String()
+// vimgrepToString formats every match in str, read from path, for -vimgrep.
+func (c *config) vimgrepToString(str string, path string) string {
+	var printBuilder strings.Builder
+	for _, m := range c.searcher().Find(path, str) {
+		c.writeVimgrep(&printBuilder, m)
 	}
 	return printBuilder.String()
 }
 
+// writeVimgrep writes a "path:line:column:text" line for each match in m, the format
+// vim's 'grepformat' and emacs' grep-mode expect, with the text of the line it starts on.
+func (c *config) writeVimgrep(b *strings.Builder, m search.Match) {
+	c.matchedLines++
+	for i, span := range m.Spans {
+		line, column := m.Position(i)
+		fmt.Fprintf(b, "%s%s%d:%d:", m.Path, c.afterName(":"), line, column)
+		if c.byteOffset {
+			fmt.Fprintf(b, "%d:", m.Offset+int64(span[0]))
+		}
+		text := lineAt(m.Text, span[0])
+		if c.replacing {
+			text = search.ReplaceAll(c.matcher, text, c.replace)
+		}
+		b.WriteString(text)
+		b.WriteByte('\n')
+	}
+}
+
+// lineAt returns the line of text holding offset, without its line terminator.
+func lineAt(text string, offset int) string {
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	end := len(text)
+	if i := strings.IndexByte(text[offset:], '\n'); i >= 0 {
+		end = offset + i
+	}
+	return strings.TrimSuffix(text[start:end], "\r")
+}
+
 // main is the entry point. It's excluded from coverage as it's a simple wrapper
 // that cannot be easily unit tested due to os.Exit().
 func main() { // coverage: ignore
 	c, err := Configure()
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		os.Exit(2)
 	}
 
-	ctx := context.Background()
-	os.Exit(c.Main(ctx))
+	// Interrupting gorep cancels the search, so the -o file is left untouched.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	status := c.Main(ctx)
+	stop()
+	os.Exit(status)
 }
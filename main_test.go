@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
-	"sync"
 	"testing"
+
+	"github.com/geofpwhite/gorep/search"
 )
 
 func TestInvalidArgs(t *testing.T) {
@@ -52,7 +55,7 @@ func TestValidArgs(t *testing.T) {
 	ctx := context.Background()
 
 	// Test inline string search
-	c, err := ConfigureWithArgs([]string{"gorep", "test", "this is a test"})
+	c, err := ConfigureWithArgs([]string{"gorep", "-text", "test", "this is a test"})
 	if err != nil {
 		t.Fatalf("Configure failed: %v", err)
 	}
@@ -65,22 +68,22 @@ func TestValidArgs(t *testing.T) {
 	os.WriteFile(tempDir+"/test1.txt", []byte("const test\nconst value"), 0o644)
 	os.WriteFile(tempDir+"/test2.txt", []byte("const another"), 0o644)
 
-	c = newConfig(regexp.MustCompile("const[a-z]{3}"), true, tempDir, "", nil, runtime.NumCPU())
-	if c.Main(ctx) != 0 {
-		t.Error("Main should return 0 for valid directory search")
+	c = newConfig(search.Regexp(regexp.MustCompile("const[a-z]{3}")), true, tempDir, "", nil, runtime.NumCPU())
+	if c.Main(ctx) != 1 {
+		t.Error("Main should return 1 for valid directory search without matches")
 	}
 	t.Chdir(pwd)
 
 	// Test file search
-	c.file = "main_test.go"
+	c.paths = []string{"main_test.go"}
 	c.outputPath = ""
-	if c.Main(ctx) != 0 {
-		t.Error("Main should return 0 for valid file search")
+	if c.Main(ctx) != 1 {
+		t.Error("Main should return 1 for valid file search without matches")
 	}
 }
 
 func TestMatchToString(t *testing.T) {
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 
 	tests := []struct {
 		name      string
@@ -148,7 +151,7 @@ func TestSearchDirectory(t *testing.T) {
 	os.Mkdir(nestedDir, 0o755)
 	os.WriteFile(nestedDir+"/file3.txt", []byte("nested test content"), 0o644)
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 2)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 2)
 
 	absPath, err := filepath.Abs(tempDir)
 	if err != nil {
@@ -177,7 +180,7 @@ func TestConcurrentSearch(t *testing.T) {
 		os.WriteFile(fmt.Sprintf("%s/file%d.txt", tempDir, i), []byte(content), 0o644)
 	}
 
-	c := newConfig(regexp.MustCompile("test"), true, tempDir, "", nil, 4)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, "", nil, 4)
 
 	absPath, err := filepath.Abs(tempDir)
 	if err != nil {
@@ -209,38 +212,41 @@ func TestMainErrorPaths(t *testing.T) {
 		tempFile := filepath.Join(t.TempDir(), "existing.txt")
 		os.WriteFile(tempFile, []byte("exists"), 0o644)
 
-		c := newConfig(regexp.MustCompile("test"), true, "", tempFile, []string{"test", "data"}, 1)
+		c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", tempFile, []string{"test", "data"}, 1)
 		exitCode := c.Main(ctx)
-		if exitCode != 1 {
-			t.Errorf("Expected exit code 1 when output file exists, got %d", exitCode)
+		if exitCode != 2 {
+			t.Errorf("Expected exit code 2 when output file exists, got %d", exitCode)
 		}
 	})
 
 	t.Run("CantCreateOutputFile", func(t *testing.T) {
-		c := newConfig(regexp.MustCompile("test"), true, "", "/invalid/path/file.txt", []string{"test", "data"}, 1)
+		c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "/invalid/path/file.txt", []string{"test", "data"}, 1)
 		exitCode := c.Main(ctx)
-		if exitCode != 1 {
-			t.Errorf("Expected exit code 1 when can't create output file, got %d", exitCode)
+		if exitCode != 2 {
+			t.Errorf("Expected exit code 2 when can't create output file, got %d", exitCode)
 		}
 	})
 
 	t.Run("InvalidFilePath", func(t *testing.T) {
-		c := newConfig(regexp.MustCompile("test"), true, "/nonexistent/file.txt", "", nil, 1)
+		c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "/nonexistent/file.txt", "", nil, 1)
 		exitCode := c.Main(ctx)
-		if exitCode != 1 {
-			t.Errorf("Expected exit code 1 for invalid file path, got %d", exitCode)
+		if exitCode != 2 {
+			t.Errorf("Expected exit code 2 for invalid file path, got %d", exitCode)
 		}
 	})
 
 	t.Run("CantReadFile", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("file permissions aren't enforced for root")
+		}
 		tempFile := filepath.Join(t.TempDir(), "unreadable.txt")
 		os.WriteFile(tempFile, []byte("test"), 0o000)
 		defer os.Chmod(tempFile, 0o644)
 
-		c := newConfig(regexp.MustCompile("test"), true, tempFile, "", nil, 1)
+		c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempFile, "", nil, 1)
 		exitCode := c.Main(ctx)
-		if exitCode != 1 {
-			t.Errorf("Expected exit code 1 for unreadable file, got %d", exitCode)
+		if exitCode != 2 {
+			t.Errorf("Expected exit code 2 for unreadable file, got %d", exitCode)
 		}
 	})
 
@@ -248,7 +254,7 @@ func TestMainErrorPaths(t *testing.T) {
 		tempFile := filepath.Join(t.TempDir(), "test.txt")
 		os.WriteFile(tempFile, []byte("test content\nmore test"), 0o644)
 
-		c := newConfig(regexp.MustCompile("test"), true, tempFile, "", nil, 1)
+		c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempFile, "", nil, 1)
 		exitCode := c.Main(ctx)
 		if exitCode != 0 {
 			t.Errorf("Expected exit code 0 for successful file search, got %d", exitCode)
@@ -264,7 +270,7 @@ func TestMatchWithOutputFile(t *testing.T) {
 	}
 	defer outputFile.Close()
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 	c.match("this is a test\nanother test line", "", outputFile)
 
 	outputFile.Close()
@@ -279,7 +285,7 @@ func TestMatchWithOutputFile(t *testing.T) {
 }
 
 func TestMatchWithNoMatches(t *testing.T) {
-	c := newConfig(regexp.MustCompile("xyz"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("xyz")), true, "", "", nil, 1)
 	c.match("this is a test", "", nil)
 	// Should not panic or error, just produce no output
 }
@@ -293,7 +299,7 @@ func TestContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 2)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 2)
 	absPath, _ := filepath.Abs(tempDir)
 
 	// Should handle cancellation gracefully
@@ -315,7 +321,7 @@ func TestWorkerWithInvalidFiles(t *testing.T) {
 	os.WriteFile(unreadableFile, []byte("test"), 0o000)
 	defer os.Chmod(unreadableFile, 0o644)
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 	absPath, _ := filepath.Abs(tempDir)
 
 	// Should skip invalid files without error
@@ -364,12 +370,98 @@ func TestConfigureWithArgsEdgeCases(t *testing.T) {
 		if c.workers != 4 {
 			t.Errorf("Expected 4 workers, got %d", c.workers)
 		}
-		if c.file != "test.txt" {
-			t.Errorf("Expected file to be test.txt, got %s", c.file)
+		if !slices.Equal(c.paths, []string{"test.txt"}) {
+			t.Errorf("Expected file to be test.txt, got %q", c.paths)
 		}
 	})
 }
 
+func TestMultiplePaths(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		os.Mkdir(filepath.Join(tempDir, dir), 0o755)
+		os.WriteFile(filepath.Join(tempDir, dir, dir+".txt"), []byte("test in "+dir), 0o644)
+	}
+	os.WriteFile(filepath.Join(tempDir, "c.txt"), []byte("no match\ntest in c"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "d.txt"), []byte("test in d"), 0o644)
+	t.Chdir(tempDir)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-f", "a", "-o", outputPath, "test", "b", "-f", "c.txt"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !slices.Equal(c.paths, []string{"a", "c.txt", "b"}) || !slices.Equal(c.args, []string{"test"}) {
+		t.Fatalf("Expected -f and the arguments after the pattern to be paths, got %q and %q", c.paths, c.args)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	content, _ := os.ReadFile(outputPath)
+	for _, want := range []string{"a.txt: \n1. test in a", "b.txt: \n1. test in b", "c.txt: \n2. test in c"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Expected the output to hold %q, got %q", want, content)
+		}
+	}
+	if strings.Contains(string(content), "test in d") {
+		t.Errorf("Expected d.txt not to be searched, got %q", content)
+	}
+
+	// Paths that can't be opened are reported, the others still searched.
+	outputPath = filepath.Join(t.TempDir(), "out.txt")
+	c, err = ConfigureWithArgs([]string{"gorep", "-o", outputPath, "test", "missing", "d.txt"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 2 {
+		t.Errorf("Expected exit code 2 with a missing path, got %d", got)
+	}
+	if content, _ := os.ReadFile(outputPath); !strings.Contains(string(content), "test in d") {
+		t.Errorf("Expected d.txt to be searched, got %q", content)
+	}
+
+	for _, args := range [][]string{
+		{"gorep", "-text", "test"},
+		{"gorep", "-text", "-f", "a", "test", "some text"},
+	} {
+		if _, err := ConfigureWithArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestNestedPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Mkdir(filepath.Join(tempDir, "d"), 0o755)
+	dup := filepath.Join(tempDir, "d", "dup.txt")
+	os.WriteFile(dup, []byte("foo\n"), 0o644)
+	t.Chdir(tempDir)
+
+	// The file is found under the directory, and given again, relative and absolute.
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-o", outputPath, "foo", "d", "d/dup.txt", dup, "./d"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != "dup.txt: \n1. foo\n" {
+		t.Errorf("Expected the file to be searched once, got %q", content)
+	}
+
+	c, err = ConfigureWithArgs([]string{"gorep", "-write", "-replace", "B$0", "foo", "d", "d/dup.txt"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	if content, _ := os.ReadFile(dup); string(content) != "Bfoo\n" {
+		t.Errorf("Expected the file to be rewritten once, got %q", content)
+	}
+}
+
 func TestSearchDirectoryWithOutputFile(t *testing.T) {
 	tempDir := t.TempDir()
 	os.WriteFile(tempDir+"/test1.txt", []byte("test content"), 0o644)
@@ -382,7 +474,7 @@ func TestSearchDirectoryWithOutputFile(t *testing.T) {
 	}
 	defer outputFile.Close()
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 2)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 2)
 	absPath, _ := filepath.Abs(tempDir)
 
 	err = c.searchDirectory(context.Background(), absPath, outputFile)
@@ -421,7 +513,7 @@ func TestMainWithStdin(t *testing.T) {
 	}()
 
 	ctx := context.Background()
-	c := newConfig(regexp.MustCompile("test"), true, "", "", []string{"test"}, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", []string{"test"}, 1)
 
 	exitCode := c.Main(ctx)
 	if exitCode != 0 {
@@ -429,6 +521,32 @@ func TestMainWithStdin(t *testing.T) {
 	}
 }
 
+func TestMainWithStdinLongLine(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	os.Stdin = r
+
+	// Lines longer than bufio.Scanner's 64 KiB limit are read whole.
+	go func() {
+		w.Write([]byte("short\n" + strings.Repeat("x", 100_000) + " test\n"))
+		w.Close()
+	}()
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", outputPath, []string{"test"}, 1)
+	if exitCode := c.Main(context.Background()); exitCode != 0 {
+		t.Errorf("Expected exit code 0 for a long stdin line, got %d", exitCode)
+	}
+	content, _ := os.ReadFile(outputPath)
+	if !strings.HasPrefix(string(content), "2. ") || !strings.HasSuffix(string(content), " test\n") {
+		t.Errorf("Expected line 2 to match, got %d bytes", len(content))
+	}
+}
+
 func TestMainWithDirectoryAndOutputFile(t *testing.T) {
 	tempDir := t.TempDir()
 	os.WriteFile(tempDir+"/file1.txt", []byte("test content"), 0o644)
@@ -437,7 +555,7 @@ func TestMainWithDirectoryAndOutputFile(t *testing.T) {
 	outputPath := filepath.Join(t.TempDir(), "output.txt")
 
 	ctx := context.Background()
-	c := newConfig(regexp.MustCompile("test"), true, tempDir, outputPath, nil, 2)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, outputPath, nil, 2)
 
 	exitCode := c.Main(ctx)
 	if exitCode != 0 {
@@ -476,37 +594,13 @@ func TestMatchWithWriteError(t *testing.T) {
 	}
 	defer outputFile.Close()
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 	// This should log an error but not panic
 	c.match("this is a test", "", outputFile)
 }
 
-func TestWorkerWithContextCancellation(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	jobs := make(chan fileJob, 1)
-	results := make(chan matchResult, 1)
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
-
-	// Start worker
-	go c.worker(ctx, jobs, results, &wg)
-
-	// Cancel context before sending jobs
-	cancel()
-	close(jobs)
-
-	wg.Wait()
-	close(results)
-
-	// Should complete without hanging
-}
-
 func TestNoTrimFlag(t *testing.T) {
-	c := newConfig(regexp.MustCompile("test"), false, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), false, "", "", nil, 1)
 
 	input := "\t\ttest content\t\t\n"
 	result := c.matchToString(input, "")
@@ -521,11 +615,11 @@ func TestEmptyDirectory(t *testing.T) {
 	tempDir := t.TempDir()
 
 	ctx := context.Background()
-	c := newConfig(regexp.MustCompile("test"), true, tempDir, "", nil, 2)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, "", nil, 2)
 
 	exitCode := c.Main(ctx)
-	if exitCode != 0 {
-		t.Errorf("Expected exit code 0 for empty directory, got %d", exitCode)
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for empty directory, got %d", exitCode)
 	}
 }
 
@@ -536,12 +630,12 @@ func TestSearchDirectoryError(t *testing.T) {
 	tempDir := t.TempDir()
 	os.WriteFile(tempDir+"/test.txt", []byte("test"), 0o644)
 
-	c := newConfig(regexp.MustCompile("test"), true, tempDir, "", nil, 2)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, "", nil, 2)
 
 	exitCode := c.Main(ctx)
 	// Should handle canceled context gracefully
-	if exitCode != 0 && exitCode != 1 {
-		t.Errorf("Expected exit code 0 or 1 for canceled context, got %d", exitCode)
+	if exitCode != 1 && exitCode != 2 {
+		t.Errorf("Expected exit code 1 or 2 for canceled context, got %d", exitCode)
 	}
 }
 
@@ -549,7 +643,7 @@ func TestMainInlineWithNoFile(t *testing.T) {
 	ctx := context.Background()
 
 	// Test the case where args > 1 but no file specified
-	c := newConfig(regexp.MustCompile("test"), true, "", "", []string{"test", "inline", "text", "with", "test"}, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", []string{"test", "inline", "text", "with", "test"}, 1)
 
 	exitCode := c.Main(ctx)
 	if exitCode != 0 {
@@ -558,7 +652,7 @@ func TestMainInlineWithNoFile(t *testing.T) {
 }
 
 func TestMatchWithNoTrim(t *testing.T) {
-	c := newConfig(regexp.MustCompile("test"), false, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), false, "", "", nil, 1)
 
 	c.match("\t\ttest content\t\t", "", nil)
 	// Should not panic or error
@@ -569,7 +663,7 @@ func TestWorkerWithNoMatches(t *testing.T) {
 	os.WriteFile(tempDir+"/nomatch.txt", []byte("no matching content here"), 0o644)
 
 	ctx := context.Background()
-	c := newConfig(regexp.MustCompile("xyz123"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("xyz123")), true, "", "", nil, 1)
 
 	absPath, _ := filepath.Abs(tempDir)
 	err := c.searchDirectory(ctx, absPath, nil)
@@ -591,7 +685,7 @@ func TestMainEntry(t *testing.T) {
 	oldArgs := os.Args
 	defer func() { os.Args = oldArgs }()
 
-	os.Args = []string{"gorep", "test", "this is a test"}
+	os.Args = []string{"gorep", "-text", "test", "this is a test"}
 
 	c, err := Configure()
 	if err != nil {
@@ -612,7 +706,7 @@ func TestMatchWithOutputFileWriteSuccess(t *testing.T) {
 	}
 	defer outputFile.Close()
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 
 	// Test with matches
 	c.match("line 1 test\nline 2 with test\nno match", "", outputFile)
@@ -628,38 +722,6 @@ func TestMatchWithOutputFileWriteSuccess(t *testing.T) {
 	}
 }
 
-func TestWorkerSelectsContextCancellation(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	jobs := make(chan fileJob, 10)
-	results := make(chan matchResult, 10)
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
-
-	// Start worker
-	go c.worker(ctx, jobs, results, &wg)
-
-	// Send a job then cancel
-	tempFile := filepath.Join(t.TempDir(), "test.txt")
-	os.WriteFile(tempFile, []byte("test content"), 0o644)
-
-	jobs <- fileJob{path: tempFile, name: "test.txt"}
-
-	// Cancel context
-	cancel()
-	close(jobs)
-
-	wg.Wait()
-	close(results)
-
-	// Drain results
-	for range results {
-	}
-}
-
 func TestSearchDirectoryWithContextDone(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -669,7 +731,7 @@ func TestSearchDirectoryWithContextDone(t *testing.T) {
 		os.WriteFile(fmt.Sprintf("%s/file%d.txt", tempDir, i), []byte("test"), 0o644)
 	}
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 	absPath, _ := filepath.Abs(tempDir)
 
 	// Cancel immediately
@@ -692,7 +754,7 @@ func TestSearchDirectoryWithWalkError(t *testing.T) {
 	os.Chmod(subdir, 0o000)
 	defer os.Chmod(subdir, 0o755)
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 	absPath, _ := filepath.Abs(tempDir)
 
 	// Should handle walk errors gracefully
@@ -711,7 +773,7 @@ func TestMatchWithWriteFailure(t *testing.T) {
 	}
 	f.Close() // Close immediately so writes will fail
 
-	c := newConfig(regexp.MustCompile("test"), true, "", "", nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
 	// This should log an error but not panic
 	c.match("this is a test", "", f)
 }
@@ -729,11 +791,11 @@ func TestMainWithStdinEmpty(t *testing.T) {
 	w.Close() // Close immediately to simulate EOF
 
 	ctx := context.Background()
-	c := newConfig(regexp.MustCompile("test"), true, "", "", []string{"test"}, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", []string{"test"}, 1)
 
 	exitCode := c.Main(ctx)
-	if exitCode != 0 {
-		t.Errorf("Expected exit code 0 for empty stdin, got %d", exitCode)
+	if exitCode != 1 {
+		t.Errorf("Expected exit code 1 for empty stdin, got %d", exitCode)
 	}
 }
 
@@ -746,7 +808,7 @@ func TestMainWithFileAndOutputFile(t *testing.T) {
 	outputFile := filepath.Join(tempDir, "output.txt")
 
 	ctx := context.Background()
-	c := newConfig(regexp.MustCompile("test"), true, testFile, outputFile, nil, 1)
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, testFile, outputFile, nil, 1)
 
 	exitCode := c.Main(ctx)
 	if exitCode != 0 {
@@ -763,3 +825,298 @@ func TestMainWithFileAndOutputFile(t *testing.T) {
 		t.Error("Output file should contain matches")
 	}
 }
+
+func TestColumnAndByteOffset(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "-column", "-byte-offset", "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !c.column || !c.byteOffset {
+		t.Fatal("Expected -column and -byte-offset to be set")
+	}
+
+	// "héllo" is 6 bytes but 5 characters, so the column and offset differ.
+	input := "first line\n\théllo test and test\n"
+	result := stripColors(c.matchToString(input, ""))
+	want := "2:8@19. héllo test and test\n"
+	if result != want {
+		t.Errorf("Expected %q, got %q", want, result)
+	}
+
+	c.byteOffset = false
+	result = stripColors(c.matchToString(input, ""))
+	if !strings.HasPrefix(result, "2:8. ") {
+		t.Errorf("Expected column only prefix, got %q", result)
+	}
+
+	c.column = false
+	c.byteOffset = true
+	result = stripColors(c.matchToString(input, ""))
+	if !strings.HasPrefix(result, "2@19. ") {
+		t.Errorf("Expected byte offset only prefix, got %q", result)
+	}
+}
+
+func TestVimgrep(t *testing.T) {
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
+	c.vimgrep = true
+
+	result := c.vimgrepToString("no match\r\n\ta test, another test\r\n", "dir/file.txt")
+	want := "dir/file.txt:2:4:\ta test, another test\n" +
+		"dir/file.txt:2:18:\ta test, another test\n"
+	if result != want {
+		t.Errorf("Expected %q, got %q", want, result)
+	}
+
+	c.byteOffset = true
+	result = c.vimgrepToString("x test\n", "f")
+	if result != "f:1:3:2:x test\n" {
+		t.Errorf("Expected byte offset after the column, got %q", result)
+	}
+}
+
+func TestVimgrepDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("one test\n"), 0o644)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-vimgrep", "-f", tempDir, "-o", outputPath, "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.Main(context.Background()) != 0 {
+		t.Fatal("Main should return 0")
+	}
+
+	content, _ := os.ReadFile(outputPath)
+	absPath, _ := filepath.Abs(filepath.Join(tempDir, "a.txt"))
+	if string(content) != absPath+":1:5:one test\n" {
+		t.Errorf("Unexpected vimgrep output %q", content)
+	}
+}
+
+func TestVimgrepInline(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-vimgrep", "-o", outputPath, "-text", "b", "abc"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.Main(context.Background()) != 0 {
+		t.Fatal("Main should return 0")
+	}
+	content, _ := os.ReadFile(outputPath)
+	if string(content) != "(standard input):1:2:abc\n" {
+		t.Errorf("Unexpected vimgrep output %q", content)
+	}
+}
+
+func TestMaxCount(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "-m", "2", "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.maxCount != 2 {
+		t.Fatalf("Expected maxCount 2, got %d", c.maxCount)
+	}
+
+	result := stripColors(c.matchToString("test 1\ntest 2\nskip\ntest 3\n", ""))
+	if result != "1. test 1\n2. test 2\n" {
+		t.Errorf("Expected only the first 2 matching lines, got %q", result)
+	}
+
+	c.vimgrep = true
+	result = c.vimgrepToString("test test\ntest\ntest\n", "f")
+	if strings.Count(result, "\n") != 3 {
+		t.Errorf("Expected the matches of 2 lines, got %q", result)
+	}
+}
+
+func TestMaxTotal(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		os.WriteFile(fmt.Sprintf("%s/file%d.txt", tempDir, i), []byte("test one\ntest two\n"), 0o644)
+	}
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-max-total", "5", "-workers", "4", "-f", tempDir, "-o", outputPath, "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.Main(context.Background()) != 0 {
+		t.Fatal("Main should return 0")
+	}
+
+	content, _ := os.ReadFile(outputPath)
+	lines := regexp.MustCompile(`(?m)^\d+\. `).FindAllString(string(content), -1)
+	if len(lines) != 5 {
+		t.Errorf("Expected 5 matching lines in total, got %d:\n%s", len(lines), content)
+	}
+}
+
+func TestMaxCountRewriting(t *testing.T) {
+	for _, args := range [][]string{
+		{"gorep", "-m", "1", "-write", "-replace", "x", "test", "."},
+		{"gorep", "-max-total", "1", "-dry-run", "-replace", "x", "test", "."},
+	} {
+		if _, err := ConfigureWithArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "match.txt"), []byte("a test\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "other.txt"), []byte("nothing\n"), 0o644)
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    int
+	}{
+		{name: "Match", pattern: "test", want: 0},
+		{name: "NoMatch", pattern: "absent", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newConfig(search.Regexp(regexp.MustCompile(tt.pattern)), true, tempDir, "", nil, 2)
+			if got := c.Main(ctx); got != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExitStatusUnreadableFile(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions aren't enforced for root")
+	}
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "match.txt"), []byte("a test\n"), 0o644)
+	unreadable := filepath.Join(tempDir, "unreadable.txt")
+	os.WriteFile(unreadable, []byte("test"), 0o000)
+	defer os.Chmod(unreadable, 0o644)
+
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, "", nil, 2)
+	if got := c.Main(ctx); got != 2 {
+		t.Errorf("Expected exit code 2 when a file can't be read, got %d", got)
+	}
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-no-messages", "-f", tempDir, "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(ctx); got != 0 {
+		t.Errorf("Expected exit code 0 with -no-messages, got %d", got)
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	for i := 0; i < 200; i++ {
+		os.WriteFile(fmt.Sprintf("%s/file%d.txt", tempDir, i), []byte("test one\ntest two\n"), 0o644)
+	}
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-q", "-workers", "2", "-f", tempDir, "-o", outputPath, "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !c.quiet {
+		t.Fatal("Expected -q to set quiet")
+	}
+	if got := c.Main(ctx); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	if n := c.matchedLines; n >= 200 {
+		t.Errorf("Expected the search to stop early, %d matches were found", n)
+	}
+	content, _ := os.ReadFile(outputPath)
+	if len(content) != 0 {
+		t.Errorf("Expected no output with -q, got %q", content)
+	}
+
+	c = newConfig(search.Regexp(regexp.MustCompile("absent")), true, tempDir, "", nil, 2)
+	c.quiet = true
+	if got := c.Main(ctx); got != 1 {
+		t.Errorf("Expected exit code 1 without matches, got %d", got)
+	}
+}
+
+func TestQuietRewriting(t *testing.T) {
+	for _, args := range [][]string{
+		{"gorep", "-q", "-write", "-replace", "New", "Old", "."},
+		{"gorep", "-q", "-dry-run", "-replace", "New", "Old", "."},
+	} {
+		if _, err := ConfigureWithArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
+
+func TestQuietIgnoresErrorsOnMatch(t *testing.T) {
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", []string{"test", "a test"}, 1)
+	c.quiet = true
+	c.failed.Store(true)
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0 with -q and a match, got %d", got)
+	}
+}
+
+func TestMatcherFlags(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "-F", "-e", "a.b", "-e", "c", "-text", "x a.b c"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := fmt.Sprintf("%T", c.matcher); got != "*search.multiLiteralMatcher" {
+		t.Fatalf("Expected a multi-literal matcher, got %s", got)
+	}
+	if len(c.args) != 2 || c.args[1] != "x a.b c" {
+		t.Errorf("Expected every argument to be text with -e, got %q", c.args)
+	}
+
+	c, err = ConfigureWithArgs([]string{"gorep", "-ignore-case", "-w", "HELLO"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.matcher.FindAll("say hello, othello", -1); !reflect.DeepEqual(got, [][]int{{4, 9}}) {
+		t.Errorf("Expected a single whole word match, got %v", got)
+	}
+
+	if _, err := ConfigureWithArgs([]string{"gorep", "-e", "("}); err == nil {
+		t.Error("Expected error for an invalid -e pattern")
+	}
+}
+
+func TestInFlag(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.go"), []byte("// test\nvar test = \"test\"\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("// test\n"), 0o644)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{"gorep", "-in", "strings", "-o", outputPath, "test", tempDir})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.scope != search.ScopeStrings {
+		t.Errorf("Expected the strings scope, got %s", c.scope)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	if content, _ := os.ReadFile(outputPath); string(content) != "a.go: \n2. var test = \"test\"\n" {
+		t.Errorf("Expected the string of a.go only, got %q", content)
+	}
+
+	for _, args := range [][]string{
+		{"gorep", "-in", "types", "test"},
+		{"gorep", "-in", "code", "-write", "-replace", "x", "test", "."},
+	} {
+		if _, err := ConfigureWithArgs(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
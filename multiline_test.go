@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiline(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "-U", `func \w+\(\)\s*\{\s*\}`})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !c.multiline {
+		t.Fatal("Expected -U to set multiline")
+	}
+
+	input := "package x\n\nfunc empty() {\n\t}\n\nfunc full() {\n\treturn\n}\nfunc a() {} func b() {\n}\n"
+	result := stripColors(c.matchToString(input, "x.go: \n"))
+	want := "x.go: \n" +
+		"3-4. func empty() {\n" +
+		"4. }\n" +
+		"9-10. func a() {} func b() {\n" +
+		"10. }\n"
+	if result != want {
+		t.Errorf("Expected:\n%q\ngot:\n%q", want, result)
+	}
+	if n := c.searcher().Stats().Matches; n != 3 {
+		t.Errorf("Expected 3 matches, got %d", n)
+	}
+	if n := c.matchedLines; n != 2 {
+		t.Errorf("Expected 2 blocks of lines, got %d", n)
+	}
+
+	colored := c.matchToString("func f() {\n}\n", "")
+	if !strings.Contains(colored, GREEN+"func f() {"+WHITE) || !strings.Contains(colored, GREEN+"}"+WHITE) {
+		t.Errorf("Expected every covered line to be highlighted, got %q", colored)
+	}
+
+	if c.matchToString("nothing here\n", "x.go: \n") != "" {
+		t.Error("Expected no output without matches")
+	}
+}
+
+func TestMultilineAnchorsAndOptions(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "-U", "-column", "-byte-offset", "-m", "1", "-no-trim", `^b.c$`})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	result := stripColors(c.matchToString("a\nb\nc\n  bxc\nbyc\n", ""))
+	if result != "2-3:1@2. b\n3. c\n" {
+		t.Errorf("Unexpected output %q", result)
+	}
+
+	c.maxCount = 0
+	c.vimgrep = true
+	result = c.vimgrepToString("a\n  bxc\nbyc\n", "f")
+	if result != "f:3:1:8:byc\n" {
+		t.Errorf("Unexpected vimgrep output %q", result)
+	}
+}
+
+func TestMultilineTrim(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "-U", `x\s+y`})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	result := stripColors(c.matchToString("\tx  \n\t  y z\t\n", ""))
+	if result != "1-2. x\n2. y z\n" {
+		t.Errorf("Unexpected output %q", result)
+	}
+
+	c.trim = false
+	result = stripColors(c.matchToString("\tx  \n\t  y z\t\n", ""))
+	if result != "1-2. \tx  \n2. \t  y z\t\n" {
+		t.Errorf("Unexpected output without trimming %q", result)
+	}
+}
+
+func TestMultilineDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("begin\nend\n"), 0o644)
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-U", "-f", tempDir, "-o", outputPath, `begin\nend`})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Fatalf("Expected exit code 0, got %d", got)
+	}
+	content, _ := os.ReadFile(outputPath)
+	if string(content) != "a.txt: \n1-2. begin\n2. end\n" {
+		t.Errorf("Unexpected output %q", content)
+	}
+}
+
+func TestMultilineWithReplace(t *testing.T) {
+	if _, err := ConfigureWithArgs([]string{"gorep", "-U", "-replace", "x", "test"}); err == nil {
+		t.Error("Expected -U and -replace to be rejected together")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// -output-mode values.
+const (
+	outputFail      = "fail"
+	outputOverwrite = "overwrite"
+	outputAppend    = "append"
+)
+
+// output collects the results saved with -o in a temporary file next to the target,
+// which only replaces it once the search has completed. An interrupted or failed run
+// therefore never leaves partial results in place of a good file.
+type output struct {
+	path string
+	tmp  *os.File
+}
+
+// openOutput prepares the -o file according to -output-mode, or returns nil when there
+// is none. Both the target and the temporary file are excluded from directory searches.
+func (c *config) openOutput() (*output, error) {
+	if c.outputPath == "" {
+		return nil, nil
+	}
+	perm := fs.FileMode(0o644)
+	info, err := os.Stat(c.outputPath)
+	exists := err == nil
+	if exists {
+		if c.outputMode == outputFail {
+			return nil, errors.New("output file already exists")
+		}
+		perm = info.Mode().Perm()
+	}
+
+	path, err := filepath.Abs(c.outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("output file couldn't be created: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".gorep-*")
+	if err != nil {
+		return nil, errors.New("output file couldn't be created")
+	}
+	o := &output{path: path, tmp: tmp}
+	if err := tmp.Chmod(perm); err != nil {
+		o.discard()
+		return nil, fmt.Errorf("output file couldn't be created: %w", err)
+	}
+	if exists && c.outputMode == outputAppend {
+		if err := o.copyFrom(c.outputPath); err != nil {
+			o.discard()
+			return nil, fmt.Errorf("can't append to output file: %w", err)
+		}
+	}
+	c.exclude = append(c.exclude, path, tmp.Name())
+	return o, nil
+}
+
+// copyFrom starts the output with the current content of path.
+func (o *output) copyFrom(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(o.tmp, f)
+	return err
+}
+
+// file is where results are written, nil without -o.
+func (o *output) file() *os.File {
+	if o == nil {
+		return nil
+	}
+	return o.tmp
+}
+
+// commit moves the completed results in place of the output file.
+func (o *output) commit() error {
+	if err := o.tmp.Close(); err != nil {
+		os.Remove(o.tmp.Name())
+		return err
+	}
+	if err := os.Rename(o.tmp.Name(), o.path); err != nil {
+		os.Remove(o.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// discard drops the results, leaving the output file as it was.
+func (o *output) discard() {
+	o.tmp.Close()
+	os.Remove(o.tmp.Name())
+}
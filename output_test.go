@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestOutputModes(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantStatus int
+		want       string
+	}{
+		{mode: outputFail, wantStatus: 2, want: "previous\n"},
+		{mode: outputOverwrite, wantStatus: 0, want: "1. a test\n"},
+		{mode: outputAppend, wantStatus: 0, want: "previous\n1. a test\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "out.txt")
+			os.WriteFile(outputPath, []byte("previous\n"), 0o600)
+
+			c, err := ConfigureWithArgs([]string{"gorep", "-o", outputPath, "-output-mode", tt.mode, "-text", "test", "a test"})
+			if err != nil {
+				t.Fatalf("ConfigureWithArgs failed: %v", err)
+			}
+			if got := c.Main(context.Background()); got != tt.wantStatus {
+				t.Errorf("Expected exit code %d, got %d", tt.wantStatus, got)
+			}
+			content, _ := os.ReadFile(outputPath)
+			if string(content) != tt.want {
+				t.Errorf("Expected output file to hold %q, got %q", tt.want, content)
+			}
+			info, _ := os.Stat(outputPath)
+			if info.Mode().Perm() != 0o600 {
+				t.Errorf("Expected permissions 0600 to be kept, got %v", info.Mode().Perm())
+			}
+			entries, _ := os.ReadDir(filepath.Dir(outputPath))
+			if len(entries) != 1 {
+				t.Errorf("Expected the temporary file to be gone, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestInvalidOutputMode(t *testing.T) {
+	if _, err := ConfigureWithArgs([]string{"gorep", "-output-mode", "clobber", "test"}); err == nil {
+		t.Error("Expected error for an unknown -output-mode")
+	}
+}
+
+func TestOutputKeptOnFailure(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	os.WriteFile(outputPath, []byte("previous\n"), 0o644)
+
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "/nonexistent/file.txt", outputPath, nil, 1)
+	c.outputMode = outputOverwrite
+	if got := c.Main(context.Background()); got != 2 {
+		t.Errorf("Expected exit code 2, got %d", got)
+	}
+
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test\n"), 0o644)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c = newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, outputPath, nil, 1)
+	c.outputMode = outputOverwrite
+	c.Main(ctx)
+
+	content, _ := os.ReadFile(outputPath)
+	if string(content) != "previous\n" {
+		t.Errorf("Expected the output file to be left alone, got %q", content)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(outputPath))
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be gone, found %d entries", len(entries))
+	}
+}
+
+func TestOutputInsideSearchedDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a test\n"), 0o644)
+	outputPath := filepath.Join(tempDir, "results.txt")
+	os.WriteFile(outputPath, []byte("old test results\n"), 0o644)
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-f", tempDir, "-o", outputPath, "-output-mode", "append", "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+
+	content, _ := os.ReadFile(outputPath)
+	if string(content) != "old test results\na.txt: \n1. a test\n" {
+		t.Errorf("Expected the output file not to be searched, got %q", content)
+	}
+	if strings.Contains(string(content), "results.txt") || strings.Contains(string(content), ".gorep-") {
+		t.Error("gorep's own output files should be excluded from the search")
+	}
+}
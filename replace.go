@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a diff.
+const diffContext = 3
+
+func (c *config) rewriting() bool {
+	return c.write || c.dryRun
+}
+
+// replaceLines applies the replacement template to each line of str on its own, the
+// same way matchToString matches them, so "\n" and "\r\n" line endings are kept as is.
+// It returns the original lines and the matching replaced lines.
+func (c *config) replaceLines(str string) (oldLines []string, newLines []string) {
+	for line := range strings.Lines(str) {
+		body, eol := search.SplitEOL(line)
+		oldLines = append(oldLines, line)
+		newLines = append(newLines, search.ReplaceAll(c.matcher, body, c.replace)+eol)
+	}
+	return oldLines, newLines
+}
+
+// rewrite applies the replacement template to content, read from path, and returns a
+// unified diff of the change (empty when nothing changed). Unless this is a dry run the
+// new content is then written back to path.
+func (c *config) rewrite(path string, content string) (string, error) {
+	oldLines, newLines := c.replaceLines(content)
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			c.matchedLines++
+		}
+	}
+	diff := unifiedDiff(path, oldLines, newLines)
+	if diff == "" || c.dryRun {
+		return diff, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(path, []byte(strings.Join(newLines, "")), info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return diff, nil
+}
+
+// rewriteFile reads the file at path and rewrites it. Errors are reported, and make the
+// search fail, rather than returned.
+func (c *config) rewriteFile(path string) string {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		var diff string
+		if diff, err = c.rewrite(path, string(content)); err == nil {
+			return diff
+		}
+	}
+	log.Printf("can't rewrite %s: %v\n", path, err)
+	c.failed.Store(true)
+	return ""
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it over
+// path, so an interrupted run leaves either the old or the new content, never a mix.
+// When path is a symbolic link, the file it points to is written, the link is kept.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".gorep-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// unifiedDiff renders the changes between oldLines and newLines in unified diff format.
+// Replacements work line by line, so oldLines[i] always corresponds to newLines[i]
+// (which may itself span several lines if the template inserted line breaks).
+func unifiedDiff(path string, oldLines, newLines []string) string {
+	var changed []int
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(BLUE)
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", path, path)
+	b.WriteString(WHITE)
+
+	// newStart[i] is the 0-based line number of newLines[i] in the new file.
+	newStart := make([]int, len(newLines)+1)
+	for i, l := range newLines {
+		newStart[i+1] = newStart[i] + lineCount(l)
+	}
+
+	for h := 0; h < len(changed); {
+		// Grow the hunk while the next change is close enough for the contexts to touch.
+		last := h
+		for last+1 < len(changed) && changed[last+1]-changed[last] <= 2*diffContext {
+			last++
+		}
+		from := max(changed[h]-diffContext, 0)
+		to := min(changed[last]+diffContext+1, len(oldLines))
+
+		b.WriteString(BLUE)
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(from, to-from), hunkRange(newStart[from], newStart[to]-newStart[from]))
+		b.WriteString(WHITE)
+		for i := from; i < to; i++ {
+			if oldLines[i] == newLines[i] {
+				writeDiffLines(&b, " ", "", oldLines[i])
+				continue
+			}
+			writeDiffLines(&b, "-", RED, oldLines[i])
+			writeDiffLines(&b, "+", GREEN, newLines[i])
+		}
+		h = last + 1
+	}
+	return b.String()
+}
+
+// hunkRange formats the start,count pair of a hunk header from a 0-based start line.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func lineCount(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
+
+func writeDiffLines(b *strings.Builder, prefix, color, text string) {
+	for line := range strings.Lines(text) {
+		body, hasEOL := strings.CutSuffix(line, "\n")
+		b.WriteString(color)
+		b.WriteString(prefix)
+		b.WriteString(body)
+		if color != "" {
+			b.WriteString(WHITE)
+		}
+		b.WriteByte('\n')
+		if !hasEOL {
+			b.WriteString("\\ No newline at end of file\n")
+		}
+	}
+}
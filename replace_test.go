@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func newReplaceConfig(pattern, template string) *config {
+	c := newConfig(search.Regexp(regexp.MustCompile(pattern)), true, "", "", nil, 1)
+	c.replace = template
+	c.replacing = true
+	return c
+}
+
+func TestReplaceLinesKeepsLineEndings(t *testing.T) {
+	c := newReplaceConfig(`foo(\d)`, "bar$1")
+
+	oldLines, newLines := c.replaceLines("foo1\r\nkeep\nfoo2")
+	want := []string{"bar1\r\n", "keep\n", "bar2"}
+	if len(oldLines) != len(want) {
+		t.Fatalf("Expected %d lines, got %d", len(want), len(oldLines))
+	}
+	for i := range want {
+		if newLines[i] != want[i] {
+			t.Errorf("Line %d: expected %q, got %q", i, want[i], newLines[i])
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	c := newReplaceConfig("old", "new")
+
+	var input strings.Builder
+	for i := 1; i <= 20; i++ {
+		if i == 2 || i == 15 {
+			input.WriteString("old line\n")
+		} else {
+			input.WriteString("context\n")
+		}
+	}
+	oldLines, newLines := c.replaceLines(input.String())
+	diff := stripColors(unifiedDiff("file.txt", oldLines, newLines))
+
+	for _, want := range []string{
+		"--- file.txt\n+++ file.txt\n",
+		"@@ -1,5 +1,5 @@\n context\n-old line\n+new line\n",
+		"@@ -12,7 +12,7 @@\n",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Expected diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+
+	if unifiedDiff("file.txt", oldLines, oldLines) != "" {
+		t.Error("Expected empty diff when nothing changed")
+	}
+}
+
+func TestUnifiedDiffNoNewlineAtEnd(t *testing.T) {
+	c := newReplaceConfig("a", "b\nc")
+
+	oldLines, newLines := c.replaceLines("a")
+	diff := stripColors(unifiedDiff("f", oldLines, newLines))
+	want := "@@ -1,1 +1,2 @@\n-a\n\\ No newline at end of file\n+b\n+c\n\\ No newline at end of file\n"
+	if !strings.Contains(diff, want) {
+		t.Errorf("Expected diff to contain %q, got:\n%s", want, diff)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "script.sh")
+	os.WriteFile(path, []byte("echo foo\r\necho bar\r\n"), 0o755)
+
+	c := newReplaceConfig("foo", "baz")
+	c.dryRun = true
+	diff, err := c.rewrite(path, "echo foo\r\necho bar\r\n")
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if !strings.Contains(diff, "echo baz") {
+		t.Errorf("Expected diff to show the replacement, got:\n%s", diff)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "echo foo\r\necho bar\r\n" {
+		t.Errorf("Dry run should leave the file untouched, got %q", content)
+	}
+
+	c.dryRun = false
+	c.write = true
+	if _, err := c.rewrite(path, string(content)); err != nil {
+		t.Fatalf("rewrite failed: %v", err)
+	}
+	content, _ = os.ReadFile(path)
+	if string(content) != "echo baz\r\necho bar\r\n" {
+		t.Errorf("Expected rewritten content with CRLF endings, got %q", content)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o755 {
+		t.Errorf("Expected permissions 0755 to be kept, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(tempDir)
+	if len(entries) != 1 {
+		t.Errorf("Expected temp file to be gone, found %d entries", len(entries))
+	}
+}
+
+func TestRewriteMissingFile(t *testing.T) {
+	c := newReplaceConfig("foo", "bar")
+	c.write = true
+	if _, err := c.rewrite(filepath.Join(t.TempDir(), "missing"), "foo"); err == nil {
+		t.Error("Expected error rewriting a file that doesn't exist")
+	}
+}
+
+func TestWriteFileAtomicBadDir(t *testing.T) {
+	if err := writeFileAtomic("/nonexistent/dir/file", []byte("x"), 0o644); err == nil {
+		t.Error("Expected error writing into a missing directory")
+	}
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	tempDir := t.TempDir()
+	real := filepath.Join(tempDir, "real.txt")
+	os.WriteFile(real, []byte("old\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "d"), 0o755)
+	link := filepath.Join(tempDir, "d", "link.txt")
+	if err := os.Symlink(filepath.Join("..", "real.txt"), link); err != nil {
+		t.Skipf("Can't create symlinks: %v", err)
+	}
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-write", "-replace", "new", "old", link})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.Main(context.Background()) != 0 {
+		t.Fatal("Main should return 0 for -write")
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected the symlink to be kept, got %v, %v", info, err)
+	}
+	if content, _ := os.ReadFile(real); string(content) != "new\n" {
+		t.Errorf("Expected the target of the link to be rewritten, got %q", content)
+	}
+}
+
+func TestWriteDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("color\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("no match\ncolor and color\n"), 0o600)
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-f", tempDir, "-write", "-replace", "colour", "colo(u)?r"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.Main(context.Background()) != 0 {
+		t.Fatal("Main should return 0 for -write")
+	}
+
+	content, _ := os.ReadFile(filepath.Join(tempDir, "sub", "b.txt"))
+	if string(content) != "no match\ncolour and colour\n" {
+		t.Errorf("Unexpected rewritten content %q", content)
+	}
+	info, _ := os.Stat(filepath.Join(tempDir, "sub", "b.txt"))
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected permissions 0600 to be kept, got %v", info.Mode().Perm())
+	}
+}
+
+func TestWriteSingleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(path, []byte("x = 1\n"), 0o644)
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-f", path, "-dry-run", "-replace", "${1}y", `(\w) =`})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if c.Main(context.Background()) != 0 {
+		t.Fatal("Main should return 0 for -dry-run")
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "x = 1\n" {
+		t.Errorf("Dry run should leave the file untouched, got %q", content)
+	}
+
+	c.dryRun = false
+	c.write = true
+	if c.Main(context.Background()) != 0 {
+		t.Fatal("Main should return 0 for -write")
+	}
+	content, _ = os.ReadFile(path)
+	if string(content) != "xy 1\n" {
+		t.Errorf("Unexpected rewritten content %q", content)
+	}
+}
+
+func TestReplaceFlagValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "WriteWithoutReplace", args: []string{"gorep", "-f", "x", "-write", "foo"}},
+		{name: "DryRunWithoutReplace", args: []string{"gorep", "-f", "x", "-dry-run", "foo"}},
+		{name: "WriteWithoutFile", args: []string{"gorep", "-write", "-replace", "bar", "foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ConfigureWithArgs(tt.args); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestMatchToStringShowsReplacement(t *testing.T) {
+	c, err := ConfigureWithArgs([]string{"gorep", "-replace", "", "foo"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !c.replacing {
+		t.Fatal("Expected an empty -replace to still enable replacing")
+	}
+	c = newReplaceConfig(`(\w+)@(\w+)`, "$2 at $1")
+	result := stripColors(c.matchToString("mail me@home now\n", ""))
+	if result != "1. mail home at me now\n" {
+		t.Errorf("Unexpected output %q", result)
+	}
+}
@@ -0,0 +1,172 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// find returns the matches in text, honoring MaxCount and MaxTotal. cancel, if not nil,
+// stops the running search once MaxTotal is reached.
+func (s *Searcher) find(path string, text string, cancel context.CancelFunc) []Match {
+	if s.opts.Multiline {
+		return s.findMultiline(path, text, cancel)
+	}
+
+	regions := s.scopeRegions(text)
+	var matches []Match
+	lineNum := 0
+	lineStart := 0
+	for line := range strings.Lines(text) {
+		lineNum++
+		offset := lineStart
+		lineStart += len(line)
+
+		m, ok := s.matchLine(path, line, lineNum, int64(offset), regions)
+		if !ok {
+			continue
+		}
+		if (s.opts.MaxCount > 0 && len(matches) == s.opts.MaxCount) || !s.takeMatch(cancel) {
+			break
+		}
+		s.stats.matches.Add(int64(len(m.Spans)))
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// matchLine returns line, the lineNum-th starting at offset, as a Match if the pattern
+// is found in it, within regions if not nil. It doesn't count it towards the limits.
+func (s *Searcher) matchLine(path string, line string, lineNum int, offset int64, regions *scopeRegions) (Match, bool) {
+	spans := regions.filter(s.findAll(line), int(offset))
+	if len(spans) == 0 {
+		return Match{}, false
+	}
+	body, _ := SplitEOL(line)
+	return Match{
+		Path:    path,
+		Line:    lineNum,
+		EndLine: lineNum,
+		Column:  utf8.RuneCountInString(line[:spans[0][0]]) + 1,
+		Offset:  offset,
+		Text:    body,
+		Spans:   clip(spans, 0, len(body)),
+	}, true
+}
+
+// findMultiline is find for Options.Multiline: the pattern runs over the whole of text,
+// and matches sharing lines are grouped into a single Match covering all of them.
+func (s *Searcher) findMultiline(path string, text string, cancel context.CancelFunc) []Match {
+	lines := newLineIndex(text)
+	var matches []Match
+	var first, last int // lines covered by the spans being grouped
+	var spans [][]int
+	flush := func() {
+		body, lastStart := lines.text(text, last)
+		start := lines[first-1]
+		matches = append(matches, Match{
+			Path:    path,
+			Line:    first,
+			EndLine: last,
+			Column:  utf8.RuneCountInString(text[start:spans[0][0]]) + 1,
+			Offset:  int64(start),
+			Text:    text[start : lastStart+len(body)],
+			Spans:   clip(spans, start, lastStart+len(body)-start),
+		})
+	}
+
+	for _, span := range s.scopeRegions(text).filter(s.findAll(text), 0) {
+		from := lines.line(span[0])
+		to := from
+		if span[1] > span[0] {
+			to = lines.line(span[1] - 1)
+		}
+		if spans != nil && from <= last {
+			last = max(last, to)
+			spans = append(spans, span)
+			s.stats.matches.Add(1)
+			continue
+		}
+		if spans != nil {
+			flush()
+			spans = nil
+		}
+		if (s.opts.MaxCount > 0 && len(matches) == s.opts.MaxCount) || !s.takeMatch(cancel) {
+			break
+		}
+		s.stats.matches.Add(1)
+		first, last, spans = from, to, [][]int{span}
+	}
+	if spans != nil {
+		flush()
+	}
+	return matches
+}
+
+// scopeRegions returns the regions of text Options.Scope covers, nil without a Scope.
+func (s *Searcher) scopeRegions(text string) *scopeRegions {
+	if s.opts.Scope == ScopeAll {
+		return nil
+	}
+	return newScopeRegions(text, s.opts.Scope)
+}
+
+func (s *Searcher) findAll(text string) [][]int {
+	if s.opts.Submatches {
+		return s.opts.Matcher.FindAllSubmatch(text, -1)
+	}
+	return s.opts.Matcher.FindAll(text, -1)
+}
+
+// clip makes the spans, found in a buffer, relative to the text at offset base in it
+// and of length n, which ends before the line terminator the matches may cover.
+func clip(spans [][]int, base int, n int) [][]int {
+	for _, span := range spans {
+		for i, x := range span {
+			if x >= 0 {
+				span[i] = min(x-base, n)
+			}
+		}
+	}
+	return spans
+}
+
+// lineIndex holds the byte offset at which each line of a buffer starts.
+type lineIndex []int
+
+func newLineIndex(str string) lineIndex {
+	starts := lineIndex{0}
+	for i := range len(str) {
+		if str[i] == '\n' && i+1 < len(str) {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// line returns the 1-based line number of the byte at offset.
+func (li lineIndex) line(offset int) int {
+	return sort.Search(len(li), func(i int) bool { return li[i] > offset })
+}
+
+// text returns line n (1-based) of str, without its line terminator, and where it starts.
+func (li lineIndex) text(str string, n int) (string, int) {
+	start, end := li[n-1], len(str)
+	if n < len(li) {
+		end = li[n]
+	}
+	text, _ := SplitEOL(str[start:end])
+	return text, start
+}
+
+// splitEOL splits line into its text and its "\n" or "\r\n" terminator, if any.
+func SplitEOL(line string) (string, string) {
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		return line[:len(line)-2], "\r\n"
+	case strings.HasSuffix(line, "\n"):
+		return line[:len(line)-1], "\n"
+	}
+	return line, ""
+}
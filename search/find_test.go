@@ -0,0 +1,113 @@
+package search
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestLineIndex(t *testing.T) {
+	str := "one\ntwo\r\nthree"
+	lines := newLineIndex(str)
+	for offset, want := range map[int]int{0: 1, 3: 1, 4: 2, 8: 2, 9: 3, 14: 3} {
+		if got := lines.line(offset); got != want {
+			t.Errorf("line(%d): expected %d, got %d", offset, want, got)
+		}
+	}
+	if text, start := lines.text(str, 2); text != "two" || start != 4 {
+		t.Errorf("Expected line 2 to be \"two\" at 4, got %q at %d", text, start)
+	}
+}
+
+func TestFind(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile(`t(e)st|(x)`))})
+
+	// "héllo" is 6 bytes but 5 characters, so the column and offset differ.
+	got := s.Find("f", "first line\r\n\théllo test and test\r\nnothing\n")
+	want := []Match{{
+		Path:    "f",
+		Line:    2,
+		EndLine: 2,
+		Column:  8,
+		Offset:  12,
+		Text:    "\théllo test and test",
+		Spans:   [][]int{{8, 12}, {17, 21}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	s = New(Options{Matcher: Regexp(regexp.MustCompile(`t(e)st|(x)`)), Submatches: true})
+	got = s.Find("f", "a test\n")
+	if spans := [][]int{{2, 6, 3, 4, -1, -1}}; !reflect.DeepEqual(got[0].Spans, spans) {
+		t.Errorf("Expected submatches %v, got %v", spans, got[0].Spans)
+	}
+}
+
+func TestFindClipsLineTerminators(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile(`b\s`))})
+	got := s.Find("f", "a b\nb\r\n")
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 matches, got %+v", got)
+	}
+	if got[0].Text != "a b" || !reflect.DeepEqual(got[0].Spans, [][]int{{2, 3}}) {
+		t.Errorf("Expected the match to stop at the end of the line, got %+v", got[0])
+	}
+	if got[1].Text != "b" || !reflect.DeepEqual(got[1].Spans, [][]int{{0, 1}}) {
+		t.Errorf("Expected CRLF to be left out, got %+v", got[1])
+	}
+}
+
+func TestFindMultiline(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile(`(?ms)func \w+\(\)\s*\{\s*\}`)), Multiline: true})
+
+	input := "package x\n\nfunc empty() {\n\t}\n\nfunc full() {\n\treturn\n}\nfunc a() {} func b() {\n}\n"
+	got := s.Find("x.go", input)
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 blocks, got %+v", got)
+	}
+	want := Match{
+		Path:    "x.go",
+		Line:    9,
+		EndLine: 10,
+		Column:  1,
+		Offset:  54,
+		Text:    "func a() {} func b() {\n}",
+		Spans:   [][]int{{0, 11}, {12, 24}},
+	}
+	if !reflect.DeepEqual(got[1], want) {
+		t.Errorf("Expected %+v, got %+v", want, got[1])
+	}
+	if line, column := got[1].Position(1); line != 9 || column != 13 {
+		t.Errorf("Expected the second match at 9:13, got %d:%d", line, column)
+	}
+	if st := s.Stats(); st.Matches != 3 || st.MatchedLines != 2 {
+		t.Errorf("Expected 3 matches in 2 blocks, got %+v", st)
+	}
+}
+
+func TestFindMaxCount(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), MaxCount: 2})
+	if got := s.Find("f", "test 1\ntest 2\nskip\ntest 3\n"); len(got) != 2 || got[1].Line != 2 {
+		t.Errorf("Expected the first 2 matching lines, got %+v", got)
+	}
+
+	s = New(Options{Matcher: Regexp(regexp.MustCompile("(?ms)^b")), Multiline: true, MaxCount: 1})
+	if got := s.Find("f", "b\na\nb\n"); len(got) != 1 || got[0].Line != 1 {
+		t.Errorf("Expected the first block only, got %+v", got)
+	}
+}
+
+func TestSplitEOL(t *testing.T) {
+	tests := []struct{ in, text, eol string }{
+		{"a\r\n", "a", "\r\n"},
+		{"a\n", "a", "\n"},
+		{"a\r", "a\r", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if text, eol := SplitEOL(tt.in); text != tt.text || eol != tt.eol {
+			t.Errorf("SplitEOL(%q) = %q, %q, want %q, %q", tt.in, text, eol, tt.text, tt.eol)
+		}
+	}
+}
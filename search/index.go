@@ -0,0 +1,364 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// IndexFile is the name of the file an Index is saved to, at the root of the tree it
+// covers. Directory searches leave it out.
+const IndexFile = ".gorep-index"
+
+// indexVersion changes whenever the format of IndexFile does.
+const indexVersion = 1
+
+// Index records the trigrams, runs of three bytes regardless of case, that the files of
+// a tree hold, so that searches can leave out the files that can't match without
+// reading them. Files it doesn't hold, or that changed since it was updated, are
+// searched as usual. See Options.Index and Searcher.UpdateIndex.
+type Index struct {
+	root string
+	data indexData
+	// ids maps the paths of data.Files to their position.
+	ids map[string]uint32
+}
+
+// indexData is what IndexFile holds.
+type indexData struct {
+	Version int
+	Files   []indexedFile
+	// Postings lists, for each trigram, the files holding it in increasing order.
+	Postings map[uint32][]uint32
+}
+
+// indexedFile is a file as it was when indexed, its path relative to the root of the
+// index and slash separated.
+type indexedFile struct {
+	Path    string
+	Size    int64
+	ModTime int64
+}
+
+func newIndexedFile(path string, info fs.FileInfo) indexedFile {
+	return indexedFile{Path: path, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+}
+
+// NewIndex returns an empty index of the tree under root.
+func NewIndex(root string) (*Index, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Index{
+		root: abs,
+		data: indexData{Version: indexVersion, Postings: make(map[uint32][]uint32)},
+		ids:  make(map[string]uint32),
+	}, nil
+}
+
+// OpenIndex reads the index saved under root.
+func OpenIndex(root string) (*Index, error) {
+	ix, err := NewIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(ix.root, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var data indexData
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid index %s: %w", f.Name(), err)
+	}
+	if data.Version != indexVersion {
+		return nil, fmt.Errorf("index %s was written by another version of gorep", f.Name())
+	}
+	ix.setData(data)
+	return ix, nil
+}
+
+func (ix *Index) setData(data indexData) {
+	ix.data = data
+	ix.ids = make(map[string]uint32, len(data.Files))
+	for id, f := range data.Files {
+		ix.ids[f.Path] = uint32(id)
+	}
+}
+
+// Root returns the absolute path of the tree the index covers.
+func (ix *Index) Root() string {
+	return ix.root
+}
+
+// Len returns the number of files the index holds.
+func (ix *Index) Len() int {
+	return len(ix.data.Files)
+}
+
+// Save writes the index to IndexFile under its root, replacing the previous one at once.
+func (ix *Index) Save() error {
+	tmp, err := os.CreateTemp(ix.root, IndexFile+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	err = gob.NewEncoder(w).Encode(ix.data)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(ix.root, IndexFile))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// UpdateIndex brings ix up to date with the files under its root, walked as a search
+// would: only the files that are new or changed since they were indexed are read, by
+// the workers. Binary files are indexed as holding nothing, and files that can't be
+// read are reported to Options.OnSkip and left out. It returns the number of files read.
+func (s *Searcher) UpdateIndex(ctx context.Context, ix *Index) (int, error) {
+	// kept holds the files that didn't change, changed the others.
+	kept := make(map[string]bool)
+	var changed []indexedFile
+	err := s.walkDir(ctx, ix.root, func(path string) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			s.skip(path, readSkipReason(err), err)
+			return nil
+		}
+		rel, _ := filepath.Rel(ix.root, path)
+		f := newIndexedFile(filepath.ToSlash(rel), info)
+		if id, ok := ix.ids[f.Path]; ok && ix.data.Files[id] == f {
+			kept[f.Path] = true
+		} else {
+			changed = append(changed, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// The files that didn't change keep their order, so that renumbering them keeps the
+	// posting lists sorted, and the files read next come after them.
+	renumber := make([]int64, len(ix.data.Files))
+	var files []indexedFile
+	for id, f := range ix.data.Files {
+		renumber[id] = -1
+		if kept[f.Path] {
+			renumber[id] = int64(len(files))
+			files = append(files, f)
+		}
+	}
+	postings := make(map[uint32][]uint32, len(ix.data.Postings))
+	for t, list := range ix.data.Postings {
+		var ids []uint32
+		for _, id := range list {
+			if n := renumber[id]; n >= 0 {
+				ids = append(ids, uint32(n))
+			}
+		}
+		if len(ids) > 0 {
+			postings[t] = ids
+		}
+	}
+
+	read, ok := s.readTrigrams(ctx, ix.root, changed)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	for i, f := range changed {
+		if !ok[i] {
+			continue
+		}
+		id := uint32(len(files))
+		files = append(files, f)
+		for _, t := range read[i] {
+			postings[t] = append(postings[t], id)
+		}
+	}
+	ix.setData(indexData{Version: indexVersion, Files: files, Postings: postings})
+	return len(changed), nil
+}
+
+// readTrigrams reads the files, relative to root, with the workers and returns their
+// trigrams, along with whether each one could be read. Binary files hold none.
+func (s *Searcher) readTrigrams(ctx context.Context, root string, files []indexedFile) ([][]uint32, []bool) {
+	read := make([][]uint32, len(files))
+	ok := make([]bool, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range s.opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				path := filepath.Join(root, filepath.FromSlash(files[i].Path))
+				readStart := time.Now()
+				content, err := os.ReadFile(path)
+				since(&s.stats.readTime, readStart)
+				if err != nil {
+					s.skip(path, readSkipReason(err), err)
+					continue
+				}
+				s.stats.bytesRead.Add(int64(len(content)))
+				ok[i] = true
+				if utf8.Valid(content) {
+					read[i] = trigrams(string(content))
+				}
+			}
+		}()
+	}
+send:
+	for i := range files {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return read, ok
+}
+
+// pruner returns, when Options.Index covers the directory root, a function telling
+// whether the file at path can be left out of the search: the index holds it unchanged
+// and rules out a match in it.
+func (s *Searcher) pruner(root string) func(path string, d fs.DirEntry) bool {
+	ix := s.opts.Index
+	if ix == nil {
+		return nil
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil
+	}
+	base, err := filepath.Rel(ix.root, abs)
+	if err != nil || base == ".." || strings.HasPrefix(base, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	candidates := ix.candidates(matcherQuery(s.opts.Matcher))
+	if candidates == nil {
+		return nil
+	}
+	return func(path string, d fs.DirEntry) bool {
+		rel, _ := filepath.Rel(root, path)
+		id, ok := ix.ids[filepath.ToSlash(filepath.Join(base, rel))]
+		if !ok || candidates[id] {
+			return false
+		}
+		info, err := d.Info()
+		return err == nil && newIndexedFile(ix.data.Files[id].Path, info) == ix.data.Files[id]
+	}
+}
+
+// candidates tells, for each file of the index, whether it may hold a match of q. It
+// returns nil when q doesn't rule any file out.
+func (ix *Index) candidates(q *query) []bool {
+	ids, all := ix.eval(q)
+	if all {
+		return nil
+	}
+	c := make([]bool, len(ix.data.Files))
+	for _, id := range ids {
+		c[id] = true
+	}
+	return c
+}
+
+// eval returns the files matching q, in increasing order, or all when they all do.
+func (ix *Index) eval(q *query) (ids []uint32, all bool) {
+	switch q.op {
+	case queryAll:
+		return nil, true
+	case queryNone:
+		return nil, false
+	case queryAnd:
+		all = true
+		restrict := func(list []uint32) {
+			if all {
+				ids, all = list, false
+			} else {
+				ids = intersect(ids, list)
+			}
+		}
+		for _, t := range q.trigrams {
+			restrict(ix.data.Postings[t])
+		}
+		for _, sub := range q.subs {
+			if list, subAll := ix.eval(sub); !subAll {
+				restrict(list)
+			}
+		}
+		return ids, all
+	default:
+		for _, t := range q.trigrams {
+			ids = union(ids, ix.data.Postings[t])
+		}
+		for _, sub := range q.subs {
+			list, subAll := ix.eval(sub)
+			if subAll {
+				return nil, true
+			}
+			ids = union(ids, list)
+		}
+		return ids, false
+	}
+}
+
+// intersect returns the ids in both sorted lists.
+func intersect(a, b []uint32) []uint32 {
+	var ids []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			ids = append(ids, a[i])
+			i++
+			j++
+		}
+	}
+	return ids
+}
+
+// union returns the ids in either sorted list.
+func union(a, b []uint32) []uint32 {
+	ids := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			ids = append(ids, a[i])
+			i++
+		case a[i] > b[j]:
+			ids = append(ids, b[j])
+			j++
+		default:
+			ids = append(ids, a[i])
+			i++
+			j++
+		}
+	}
+	ids = append(ids, a[i:]...)
+	return append(ids, b[j:]...)
+}
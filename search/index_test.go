@@ -0,0 +1,147 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+// searchPaths returns the sorted paths, relative to root, of the files s finds matches
+// in under root.
+func searchPaths(t *testing.T, s *Searcher, root string) []string {
+	t.Helper()
+	var paths []string
+	for m, err := range s.Search(context.Background(), root) {
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		rel, _ := filepath.Rel(root, m.Path)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+func TestUpdateIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("alpha\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("beta\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "bin"), []byte("alpha\xff\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "vendor"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "vendor", "c.txt"), []byte("alpha\n"), 0o644)
+
+	s := New(Options{Workers: 2, Ignore: []string{"vendor"}})
+	ix, err := NewIndex(tempDir)
+	if err != nil {
+		t.Fatalf("NewIndex failed: %v", err)
+	}
+	ctx := context.Background()
+	if n, err := s.UpdateIndex(ctx, ix); err != nil || n != 3 || ix.Len() != 3 {
+		t.Fatalf("Expected 3 files to be indexed, got %d read, %d indexed (%v)", n, ix.Len(), err)
+	}
+	if n, _ := s.UpdateIndex(ctx, ix); n != 0 {
+		t.Errorf("Expected nothing to be read again, got %d", n)
+	}
+
+	os.Remove(filepath.Join(tempDir, "a.txt"))
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("beta alpha\n"), 0o644)
+	os.Chtimes(filepath.Join(tempDir, "b.txt"), time.Now(), time.Now().Add(time.Minute))
+	os.WriteFile(filepath.Join(tempDir, "d.txt"), []byte("delta\n"), 0o644)
+	if n, err := s.UpdateIndex(ctx, ix); err != nil || n != 2 || ix.Len() != 3 {
+		t.Fatalf("Expected the 2 new or changed files to be read, got %d read, %d indexed (%v)", n, ix.Len(), err)
+	}
+
+	m, _ := NewMatcher([]string{"alpha"}, MatcherOptions{})
+	var got []string
+	for id, ok := range ix.candidates(matcherQuery(m)) {
+		if ok {
+			got = append(got, ix.data.Files[id].Path)
+		}
+	}
+	if !slices.Equal(got, []string{"b.txt"}) {
+		t.Errorf("Expected only b.txt to hold alpha, got %v", got)
+	}
+}
+
+func TestSaveOpenIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("alpha\n"), 0o644)
+	if _, err := OpenIndex(tempDir); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing index to be reported, got %v", err)
+	}
+
+	ix, _ := NewIndex(tempDir)
+	New(Options{}).UpdateIndex(context.Background(), ix)
+	if err := ix.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	opened, err := OpenIndex(tempDir)
+	if err != nil {
+		t.Fatalf("OpenIndex failed: %v", err)
+	}
+	if opened.Root() != ix.Root() || opened.Len() != 1 || len(opened.data.Postings) != len(ix.data.Postings) {
+		t.Errorf("Expected the saved index back, got %+v", opened.data)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 2 {
+		t.Errorf("Expected the temporary file to be gone, got %v", entries)
+	}
+
+	ix.data.Version = indexVersion + 1
+	ix.Save()
+	if _, err := OpenIndex(tempDir); err == nil {
+		t.Error("Expected an index of another version to be refused")
+	}
+	os.WriteFile(filepath.Join(tempDir, IndexFile), []byte("garbage"), 0o644)
+	if _, err := OpenIndex(tempDir); err == nil {
+		t.Error("Expected an invalid index to be refused")
+	}
+}
+
+func TestSearchWithIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("func alpha\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("beta\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "sub", "c.txt"), []byte("gamma\n"), 0o644)
+	ix, _ := NewIndex(tempDir)
+	New(Options{}).UpdateIndex(context.Background(), ix)
+	ix.Save()
+
+	m, _ := NewMatcher([]string{"alpha|gamma"}, MatcherOptions{})
+	s := New(Options{Matcher: m, Index: ix})
+	if got := searchPaths(t, s, tempDir); !slices.Equal(got, []string{"a.txt", "sub/c.txt"}) {
+		t.Errorf("Unexpected matches %v", got)
+	}
+	if st := s.Stats(); st.FilesPruned != 1 || st.FilesSearched != 2 || st.FilesWalked != 3 {
+		t.Errorf("Expected b.txt to be pruned and the index file left out, got %+v", st)
+	}
+
+	// Changed and new files are searched whatever the index says.
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("beta gamma\n"), 0o644)
+	os.Chtimes(filepath.Join(tempDir, "b.txt"), time.Now(), time.Now().Add(time.Minute))
+	os.WriteFile(filepath.Join(tempDir, "sub", "d.txt"), []byte("alpha\n"), 0o644)
+	s = New(Options{Matcher: m, Index: ix})
+	if got := searchPaths(t, s, tempDir); !slices.Equal(got, []string{"a.txt", "b.txt", "sub/c.txt", "sub/d.txt"}) {
+		t.Errorf("Unexpected matches %v", got)
+	}
+
+	// The index also covers the directories under its root.
+	s = New(Options{Matcher: Regexp(regexp.MustCompile("alpha")), Index: ix})
+	if got := searchPaths(t, s, filepath.Join(tempDir, "sub")); !slices.Equal(got, []string{"d.txt"}) {
+		t.Errorf("Unexpected matches %v", got)
+	}
+	if st := s.Stats(); st.FilesPruned != 1 {
+		t.Errorf("Expected sub/c.txt to be pruned, got %+v", st)
+	}
+
+	// But not the trees outside of it.
+	other := t.TempDir()
+	os.WriteFile(filepath.Join(other, "b.txt"), []byte("alpha\n"), 0o644)
+	if got := searchPaths(t, s, other); !slices.Equal(got, []string{"b.txt"}) {
+		t.Errorf("Unexpected matches %v", got)
+	}
+}
@@ -0,0 +1,241 @@
+package search
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Matcher finds occurrences of the search pattern. Searches only deal with spans, so a
+// new way of matching only needs a new Matcher.
+type Matcher interface {
+	// FindAll returns the start and end of up to n successive non-overlapping matches
+	// in s (all of them when n < 0), like regexp's FindAllStringIndex.
+	FindAll(s string, n int) [][]int
+	// FindAllSubmatch is FindAll with, after the bounds of each match, the bounds of
+	// each capture group (-1 for groups that didn't participate), like regexp's
+	// FindAllStringSubmatchIndex.
+	FindAllSubmatch(s string, n int) [][]int
+	// Expand appends template to dst with $1, ${name}... replaced by the corresponding
+	// submatches of match, a span found by FindAllSubmatch in src, like regexp's Expand.
+	Expand(dst []byte, template string, src string, match []int) []byte
+	// Literals returns strings of which every match contains at least one, so text
+	// holding none of them can be skipped without running the matcher, or nil when no
+	// such prefilter is available.
+	Literals() []string
+}
+
+// MatcherOptions tells NewMatcher how to read its patterns.
+type MatcherOptions struct {
+	// Fixed takes the patterns as literal strings rather than regular expressions.
+	Fixed bool
+	// IgnoreCase matches regardless of case.
+	IgnoreCase bool
+	// Word only matches whole words.
+	Word bool
+	// Multiline lets . match newlines and ^/$ match at line boundaries, for searches
+	// with Options.Multiline set.
+	Multiline bool
+}
+
+// NewMatcher returns a Matcher finding any of the patterns: a literal one when they are
+// fixed strings and nothing else calls for a regular expression, RE2 otherwise.
+func NewMatcher(patterns []string, opts MatcherOptions) (Matcher, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("no pattern given")
+	}
+	if opts.Fixed && !opts.IgnoreCase && !opts.Word && !slices.Contains(patterns, "") {
+		return FixedStrings(patterns...), nil
+	}
+
+	alternatives := make([]string, len(patterns))
+	for i, p := range patterns {
+		if opts.Fixed {
+			p = regexp.QuoteMeta(p)
+		}
+		alternatives[i] = p
+	}
+	pattern := alternatives[0]
+	if len(alternatives) > 1 {
+		pattern = "(?:" + strings.Join(alternatives, ")|(?:") + ")"
+	}
+	if opts.Word {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	var flags string
+	if opts.Multiline {
+		// Let . match newlines and ^/$ match at line boundaries, the pattern now seeing
+		// the whole input at once.
+		flags += "ms"
+	}
+	if opts.IgnoreCase {
+		flags += "i"
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return regexpMatcher{re}, nil
+}
+
+// Regexp returns a Matcher for a compiled regular expression.
+func Regexp(re *regexp.Regexp) Matcher {
+	return regexpMatcher{re}
+}
+
+// regexpMatcher matches a Go (RE2) regular expression.
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexpMatcher) FindAll(s string, n int) [][]int {
+	return m.re.FindAllStringIndex(s, n)
+}
+
+func (m regexpMatcher) FindAllSubmatch(s string, n int) [][]int {
+	return m.re.FindAllStringSubmatchIndex(s, n)
+}
+
+func (m regexpMatcher) Expand(dst []byte, template string, src string, match []int) []byte {
+	return m.re.ExpandString(dst, template, src, match)
+}
+
+func (m regexpMatcher) Literals() []string {
+	// Every match starts with the literal prefix, if the pattern has one.
+	if prefix, _ := m.re.LiteralPrefix(); prefix != "" {
+		return []string{prefix}
+	}
+	return nil
+}
+
+// noGroups expands templates for matchers without capture groups: only $0 is set.
+var noGroups = regexp.MustCompile("")
+
+// FixedStrings returns a Matcher for any of the given literal, non empty, strings.
+func FixedStrings(literals ...string) Matcher {
+	if len(literals) == 1 {
+		return fixedMatcher(literals[0])
+	}
+	return newMultiLiteralMatcher(literals)
+}
+
+// fixedMatcher matches a literal, non empty, string.
+type fixedMatcher string
+
+func (m fixedMatcher) FindAll(s string, n int) [][]int {
+	var spans [][]int
+	for start := 0; n < 0 || len(spans) < n; {
+		i := strings.Index(s[start:], string(m))
+		if i < 0 {
+			break
+		}
+		start += i
+		spans = append(spans, []int{start, start + len(m)})
+		start += len(m)
+	}
+	return spans
+}
+
+func (m fixedMatcher) FindAllSubmatch(s string, n int) [][]int {
+	return m.FindAll(s, n)
+}
+
+func (m fixedMatcher) Expand(dst []byte, template string, src string, match []int) []byte {
+	return noGroups.ExpandString(dst, template, src, match)
+}
+
+func (m fixedMatcher) Literals() []string {
+	return []string{string(m)}
+}
+
+// multiLiteralMatcher matches any of several literal, non empty, strings. At each
+// position the longest one wins, as with grep -F.
+type multiLiteralMatcher struct {
+	literals []string
+}
+
+func newMultiLiteralMatcher(literals []string) *multiLiteralMatcher {
+	return &multiLiteralMatcher{literals: literals}
+}
+
+func (m *multiLiteralMatcher) FindAll(s string, n int) [][]int {
+	// next[i] is where literals[i] next occurs at or after the current position, or -1.
+	next := make([]int, len(m.literals))
+	for i, lit := range m.literals {
+		next[i] = strings.Index(s, lit)
+	}
+
+	var spans [][]int
+	for start := 0; n < 0 || len(spans) < n; {
+		best := -1
+		for i, lit := range m.literals {
+			if next[i] >= 0 && next[i] < start {
+				if j := strings.Index(s[start:], lit); j >= 0 {
+					next[i] = start + j
+				} else {
+					next[i] = -1
+				}
+			}
+			if next[i] < 0 {
+				continue
+			}
+			if best < 0 || next[i] < next[best] || (next[i] == next[best] && len(lit) > len(m.literals[best])) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		end := next[best] + len(m.literals[best])
+		spans = append(spans, []int{next[best], end})
+		start = end
+	}
+	return spans
+}
+
+func (m *multiLiteralMatcher) FindAllSubmatch(s string, n int) [][]int {
+	return m.FindAll(s, n)
+}
+
+func (m *multiLiteralMatcher) Expand(dst []byte, template string, src string, match []int) []byte {
+	return noGroups.ExpandString(dst, template, src, match)
+}
+
+func (m *multiLiteralMatcher) Literals() []string {
+	return m.literals
+}
+
+// ReplaceAll returns s with every match of m replaced by template, expanded.
+func ReplaceAll(m Matcher, s string, template string) string {
+	spans := m.FindAllSubmatch(s, -1)
+	if len(spans) == 0 {
+		return s
+	}
+	var b []byte
+	last := 0
+	for _, span := range spans {
+		b = append(b, s[last:span[0]]...)
+		b = m.Expand(b, template, s, span)
+		last = span[1]
+	}
+	return string(append(b, s[last:]...))
+}
+
+// mayMatch tells whether s contains one of the matcher's literals, if it has any, and
+// could therefore match.
+func mayMatch(m Matcher, s string) bool {
+	literals := m.Literals()
+	if literals == nil {
+		return true
+	}
+	for _, lit := range literals {
+		if strings.Contains(s, lit) {
+			return true
+		}
+	}
+	return false
+}
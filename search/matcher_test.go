@@ -0,0 +1,119 @@
+package search
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestNewMatcherSelection(t *testing.T) {
+	tests := []struct {
+		name                           string
+		patterns                       []string
+		fixed, ignoreCase, word, multi bool
+		want                           string
+	}{
+		{name: "Regexp", patterns: []string{"a+"}, want: "search.regexpMatcher"},
+		{name: "Fixed", patterns: []string{"a+"}, fixed: true, want: "search.fixedMatcher"},
+		{name: "MultiLiteral", patterns: []string{"a", "b"}, fixed: true, want: "*search.multiLiteralMatcher"},
+		{name: "FixedIgnoreCase", patterns: []string{"a+"}, fixed: true, ignoreCase: true, want: "search.regexpMatcher"},
+		{name: "FixedWord", patterns: []string{"a"}, fixed: true, word: true, want: "search.regexpMatcher"},
+		{name: "FixedEmpty", patterns: []string{""}, fixed: true, want: "search.regexpMatcher"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.patterns, MatcherOptions{Fixed: tt.fixed, IgnoreCase: tt.ignoreCase, Word: tt.word, Multiline: tt.multi})
+			if err != nil {
+				t.Fatalf("NewMatcher failed: %v", err)
+			}
+			if got := reflect.TypeOf(m).String(); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := NewMatcher([]string{"[oops"}, MatcherOptions{}); err == nil {
+		t.Error("Expected error for an invalid regular expression")
+	}
+	if _, err := NewMatcher(nil, MatcherOptions{}); err == nil {
+		t.Error("Expected error without patterns")
+	}
+	if got := reflect.TypeOf(FixedStrings("a")).String(); got != "search.fixedMatcher" {
+		t.Errorf("Expected a single literal to use fixedMatcher, got %s", got)
+	}
+}
+
+func TestMatcherFindAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		fixed    bool
+		ignore   bool
+		word     bool
+		input    string
+		want     [][]int
+	}{
+		{name: "Regexp", patterns: []string{"o+"}, input: "foo bo", want: [][]int{{1, 3}, {5, 6}}},
+		{name: "Fixed", patterns: []string{"a.b"}, fixed: true, input: "a.b axb a.ba.b", want: [][]int{{0, 3}, {8, 11}, {11, 14}}},
+		{name: "FixedNoMatch", patterns: []string{"zz"}, fixed: true, input: "abc", want: nil},
+		{name: "MultiLiteralLongest", patterns: []string{"ab", "abcd", "cd"}, fixed: true, input: "xabcdcd", want: [][]int{{1, 5}, {5, 7}}},
+		{name: "IgnoreCase", patterns: []string{"ab"}, fixed: true, ignore: true, input: "AB ab", want: [][]int{{0, 2}, {3, 5}}},
+		{name: "Word", patterns: []string{"cat"}, word: true, input: "cat concat cat.", want: [][]int{{0, 3}, {11, 14}}},
+		{name: "SeveralRegexps", patterns: []string{"a+", "b"}, input: "aab", want: [][]int{{0, 2}, {2, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.patterns, MatcherOptions{Fixed: tt.fixed, IgnoreCase: tt.ignore, Word: tt.word})
+			if err != nil {
+				t.Fatalf("NewMatcher failed: %v", err)
+			}
+			if got := m.FindAll(tt.input, -1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAll: expected %v, got %v", tt.want, got)
+			}
+			if got := m.FindAllSubmatch(tt.input, -1); len(got) != len(tt.want) {
+				t.Errorf("FindAllSubmatch: expected %d matches, got %v", len(tt.want), got)
+			}
+			if len(tt.want) > 1 {
+				if got := m.FindAll(tt.input, 1); len(got) != 1 {
+					t.Errorf("FindAll with n=1: expected 1 match, got %v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestMatcherLiterals(t *testing.T) {
+	if got := (regexpMatcher{regexp.MustCompile(`func\s+\w+`)}).Literals(); !reflect.DeepEqual(got, []string{"func"}) {
+		t.Errorf("Expected the literal prefix, got %v", got)
+	}
+	if got := (regexpMatcher{regexp.MustCompile(`\w+`)}).Literals(); got != nil {
+		t.Errorf("Expected no literals, got %v", got)
+	}
+
+	m := newMultiLiteralMatcher([]string{"foo", "bar"})
+	if !mayMatch(m, "a bar") || mayMatch(m, "nothing") {
+		t.Error("mayMatch should look for any of the literals")
+	}
+	if !mayMatch(regexpMatcher{regexp.MustCompile(`\d`)}, "x") {
+		t.Error("mayMatch should be true without literals")
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	tests := []struct {
+		m        Matcher
+		template string
+		input    string
+		want     string
+	}{
+		{regexpMatcher{regexp.MustCompile(`(\w+)=(\w+)`)}, "$2=$1", "a=b, c=d", "b=a, d=c"},
+		{fixedMatcher("$x"), "[$0]", "1 $x 2", "1 [$x] 2"},
+		{newMultiLiteralMatcher([]string{"a", "b"}), "${0}${0}", "abc", "aabbc"},
+		{fixedMatcher("zz"), "y", "abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := ReplaceAll(tt.m, tt.input, tt.template); got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+}
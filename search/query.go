@@ -0,0 +1,243 @@
+package search
+
+import (
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// queryOp is the kind of a query node.
+type queryOp int
+
+const (
+	queryAll  queryOp = iota // every file
+	queryNone                // no file
+	queryAnd                 // files holding all the trigrams and matching all the subs
+	queryOr                  // files holding any of the trigrams or matching any of the subs
+)
+
+// query selects the files of an Index that may hold a match, from the trigrams every
+// match has to contain. Trigrams are those of the lowercased text, see trigrams.
+type query struct {
+	op       queryOp
+	trigrams []uint32
+	subs     []*query
+}
+
+var (
+	allQuery  = &query{op: queryAll}
+	noneQuery = &query{op: queryNone}
+)
+
+func andQuery(a, b *query) *query {
+	switch {
+	case a.op == queryNone || b.op == queryNone:
+		return noneQuery
+	case a.op == queryAll:
+		return b
+	case b.op == queryAll:
+		return a
+	}
+	return &query{op: queryAnd, subs: []*query{a, b}}
+}
+
+func orQuery(a, b *query) *query {
+	switch {
+	case a.op == queryAll || b.op == queryAll:
+		return allQuery
+	case a.op == queryNone:
+		return b
+	case b.op == queryNone:
+		return a
+	}
+	return &query{op: queryOr, subs: []*query{a, b}}
+}
+
+// literalQuery selects the files holding s, lowercased, which needs s to be at least
+// three bytes long to rule anything out.
+func literalQuery(s string) *query {
+	t := trigrams(s)
+	if len(t) == 0 {
+		return allQuery
+	}
+	return &query{op: queryAnd, trigrams: t}
+}
+
+// matcherQuery returns the query selecting the files in which m may match: from the
+// structure of the regular expression for regexp matchers, from the literals otherwise.
+func matcherQuery(m Matcher) *query {
+	if rm, ok := m.(regexpMatcher); ok {
+		re, err := syntax.Parse(rm.re.String(), syntax.Perl)
+		if err != nil {
+			return allQuery
+		}
+		return analyze(re.Simplify()).query()
+	}
+	literals := m.Literals()
+	if literals == nil {
+		return allQuery
+	}
+	q := noneQuery
+	for _, lit := range literals {
+		q = orQuery(q, literalQuery(lit))
+	}
+	return q
+}
+
+// maxExact bounds the number of strings regexpInfo.exact holds, past which the
+// alternatives they stand for are turned into a query.
+const maxExact = 16
+
+// regexpInfo is what analyze knows of the strings a regular expression matches: all
+// of them, lowercased, when exact isn't nil, and a query they satisfy otherwise.
+type regexpInfo struct {
+	exact []string
+	match *query
+}
+
+func exactInfo(s ...string) regexpInfo {
+	return regexpInfo{exact: s}
+}
+
+var anyInfo = regexpInfo{match: allQuery}
+
+// query returns the query the matches described by info satisfy.
+func (info regexpInfo) query() *query {
+	if info.exact == nil {
+		return info.match
+	}
+	q := noneQuery
+	for _, s := range info.exact {
+		q = orQuery(q, literalQuery(s))
+	}
+	return q
+}
+
+// analyze works out what the strings matched by re have in common. It's only meant to
+// be cheap and sound: whatever it can't describe precisely matches anything.
+func analyze(re *syntax.Regexp) regexpInfo {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return regexpInfo{match: noneQuery}
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText,
+		syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return exactInfo("")
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 && !allFoldToLower(re.Rune) {
+			return anyInfo
+		}
+		return exactInfo(strings.ToLower(string(re.Rune)))
+	case syntax.OpCharClass:
+		return classInfo(re.Rune)
+	case syntax.OpCapture:
+		return analyze(re.Sub[0])
+	case syntax.OpQuest:
+		sub := analyze(re.Sub[0])
+		if sub.exact == nil {
+			return anyInfo
+		}
+		return exactInfo(append([]string{""}, sub.exact...)...)
+	case syntax.OpPlus:
+		return regexpInfo{match: analyze(re.Sub[0]).query()}
+	case syntax.OpRepeat:
+		if re.Min == 0 {
+			return anyInfo
+		}
+		return regexpInfo{match: analyze(re.Sub[0]).query()}
+	case syntax.OpConcat:
+		info := exactInfo("")
+		for _, sub := range re.Sub {
+			info = concatInfo(info, analyze(sub))
+		}
+		return info
+	case syntax.OpAlternate:
+		info := analyze(re.Sub[0])
+		for _, sub := range re.Sub[1:] {
+			info = alternateInfo(info, analyze(sub))
+		}
+		return info
+	}
+	// Any character, repetitions that can be empty...
+	return anyInfo
+}
+
+// concatInfo describes x followed by y.
+func concatInfo(x, y regexpInfo) regexpInfo {
+	if x.exact != nil && y.exact != nil && len(x.exact)*len(y.exact) <= maxExact {
+		var exact []string
+		for _, a := range x.exact {
+			for _, b := range y.exact {
+				exact = append(exact, a+b)
+			}
+		}
+		return exactInfo(dedup(exact)...)
+	}
+	return regexpInfo{match: andQuery(x.query(), y.query())}
+}
+
+// alternateInfo describes x or y.
+func alternateInfo(x, y regexpInfo) regexpInfo {
+	if x.exact != nil && y.exact != nil && len(x.exact)+len(y.exact) <= maxExact {
+		return exactInfo(dedup(append(slices.Clone(x.exact), y.exact...))...)
+	}
+	return regexpInfo{match: orQuery(x.query(), y.query())}
+}
+
+// classInfo describes a character class, given as pairs of bounds, by the characters it
+// holds when there are few of them.
+func classInfo(ranges []rune) regexpInfo {
+	if len(ranges) == 0 {
+		return regexpInfo{match: noneQuery}
+	}
+	n := 0
+	for i := 0; i < len(ranges); i += 2 {
+		n += int(ranges[i+1]-ranges[i]) + 1
+		if n > maxExact {
+			return anyInfo
+		}
+	}
+	var exact []string
+	for i := 0; i < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1]; r++ {
+			exact = append(exact, strings.ToLower(string(r)))
+		}
+	}
+	return exactInfo(dedup(exact)...)
+}
+
+// allFoldToLower tells whether every character matching one of runes regardless of case
+// lowercases like it does, so that lowercasing is enough to find them all. It isn't the
+// case of the few characters folding with more than their upper and lower case, such as
+// s and ſ.
+func allFoldToLower(runes []rune) bool {
+	for _, r := range runes {
+		lower := unicode.ToLower(r)
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if unicode.ToLower(f) != lower {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func dedup(s []string) []string {
+	slices.Sort(s)
+	return slices.Compact(s)
+}
+
+// trigrams returns the distinct trigrams of s lowercased, sorted: its runs of three
+// bytes, each packed in a uint32.
+func trigrams(s string) []uint32 {
+	s = strings.ToLower(s)
+	if len(s) < 3 {
+		return nil
+	}
+	t := make([]uint32, 0, len(s)-2)
+	for i := 0; i+3 <= len(s); i++ {
+		t = append(t, uint32(s[i])<<16|uint32(s[i+1])<<8|uint32(s[i+2]))
+	}
+	slices.Sort(t)
+	return slices.Compact(t)
+}
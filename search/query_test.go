@@ -0,0 +1,100 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTrigrams(t *testing.T) {
+	got := trigrams("AbcAbc")
+	want := []uint32{'a'<<16 | 'b'<<8 | 'c', 'b'<<16 | 'c'<<8 | 'a', 'c'<<16 | 'a'<<8 | 'b'}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := trigrams("ab"); got != nil {
+		t.Errorf("Expected no trigrams in a short string, got %v", got)
+	}
+}
+
+func TestMatcherQuery(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"hello.txt":   "Hello, world\n",
+		"goodbye.txt": "goodbye\n",
+		"func.go":     "func main() {}\nfunc helper() {}\n",
+		"strasse.txt": "STRAſSE\n",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o644)
+	}
+	ix, err := NewIndex(tempDir)
+	if err != nil {
+		t.Fatalf("NewIndex failed: %v", err)
+	}
+	if _, err := New(Options{}).UpdateIndex(context.Background(), ix); err != nil {
+		t.Fatalf("UpdateIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		patterns []string
+		opts     MatcherOptions
+		want     []string // nil when no file can be ruled out
+	}{
+		{patterns: []string{"hello"}, want: []string{"hello.txt"}},
+		{patterns: []string{"HELLO"}, opts: MatcherOptions{IgnoreCase: true}, want: []string{"hello.txt"}},
+		{patterns: []string{"hello|goodbye"}, want: []string{"goodbye.txt", "hello.txt"}},
+		{patterns: []string{"hello", "bye"}, opts: MatcherOptions{Fixed: true}, want: []string{"goodbye.txt", "hello.txt"}},
+		{patterns: []string{`func \w+\(\)`}, want: []string{"func.go"}},
+		{patterns: []string{`f[ou]nc (main|help)`}, want: []string{"func.go"}},
+		{patterns: []string{`(good)?bye`}, want: []string{"goodbye.txt"}},
+		{patterns: []string{`good(bye)+`}, want: []string{"goodbye.txt"}},
+		{patterns: []string{`hel{2}o`}, want: []string{"hello.txt"}},
+		{patterns: []string{`nowhere`}, want: []string{}},
+		{patterns: []string{`good.*world`}, want: []string{}},
+		{patterns: []string{`\bhello\b`}, opts: MatcherOptions{Word: true}, want: []string{"hello.txt"}},
+		// ſ matches s regardless of case, which lowercasing doesn't tell.
+		{patterns: []string{"strasse"}, opts: MatcherOptions{IgnoreCase: true}, want: nil},
+		{patterns: []string{"he"}, want: nil},
+		{patterns: []string{"h.llo"}, want: []string{"hello.txt"}},
+		{patterns: []string{"h.l.o"}, want: nil},
+		{patterns: []string{"[a-z]+"}, want: nil},
+		{patterns: []string{"(hello)*"}, want: nil},
+	}
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.patterns, tt.opts)
+		if err != nil {
+			t.Fatalf("NewMatcher(%q) failed: %v", tt.patterns, err)
+		}
+		candidates := ix.candidates(matcherQuery(m))
+		if tt.want == nil {
+			if candidates != nil {
+				t.Errorf("%q: Expected no file to be ruled out, got %v", tt.patterns, candidates)
+			}
+			continue
+		}
+		got := []string{}
+		for id, ok := range candidates {
+			if ok {
+				got = append(got, ix.data.Files[id].Path)
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: Expected %v, got %v", tt.patterns, tt.want, got)
+		}
+	}
+}
+
+func TestIntersectUnion(t *testing.T) {
+	a, b := []uint32{1, 3, 5, 7}, []uint32{2, 3, 7, 9}
+	if got := intersect(a, b); !slices.Equal(got, []uint32{3, 7}) {
+		t.Errorf("Unexpected intersection %v", got)
+	}
+	if got := union(a, b); !slices.Equal(got, []uint32{1, 2, 3, 5, 7, 9}) {
+		t.Errorf("Unexpected union %v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package search
+
+import (
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scope restricts the matches to some syntactic regions of Go source files.
+type Scope int
+
+const (
+	// ScopeAll doesn't restrict the matches, nor the files searched.
+	ScopeAll Scope = iota
+	ScopeComments
+	// ScopeStrings covers string and rune literals.
+	ScopeStrings
+	ScopeIdentifiers
+	// ScopeCode covers everything but comments and string and rune literals.
+	ScopeCode
+)
+
+func (sc Scope) String() string {
+	switch sc {
+	case ScopeAll:
+		return "all"
+	case ScopeComments:
+		return "comments"
+	case ScopeStrings:
+		return "strings"
+	case ScopeIdentifiers:
+		return "identifiers"
+	case ScopeCode:
+		return "code"
+	default:
+		return "Scope(" + strconv.Itoa(int(sc)) + ")"
+	}
+}
+
+// scopeRegions holds the regions of a source file a Scope covers or, with exclude, those
+// it doesn't.
+type scopeRegions struct {
+	// starts and ends of the regions, in order.
+	starts, ends []int
+	exclude      bool
+}
+
+// newScopeRegions tokenizes the Go source src to find the regions of scope. Syntax
+// errors are ignored: what can be tokenized still counts.
+func newScopeRegions(src string, scope Scope) *scopeRegions {
+	r := &scopeRegions{exclude: scope == ScopeCode}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var sc scanner.Scanner
+	sc.Init(file, []byte(src), nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == token.EOF {
+			return r
+		}
+		var in bool
+		switch tok {
+		case token.COMMENT:
+			in = scope == ScopeComments || scope == ScopeCode
+		case token.STRING, token.CHAR:
+			in = scope == ScopeStrings || scope == ScopeCode
+		case token.IDENT:
+			in = scope == ScopeIdentifiers
+		}
+		if in {
+			start := file.Offset(pos)
+			r.starts = append(r.starts, start)
+			r.ends = append(r.ends, tokenEnd(src, start, tok, lit))
+		}
+	}
+}
+
+// tokenEnd returns the offset in src right after the token tok starting at start. lit
+// can't tell for comments and raw strings, the scanner strips their carriage returns.
+func tokenEnd(src string, start int, tok token.Token, lit string) int {
+	end := len(src)
+	switch {
+	case tok == token.COMMENT && strings.HasPrefix(lit, "//"):
+		if i := strings.IndexByte(src[start:], '\n'); i >= 0 {
+			end = start + i
+		}
+	case tok == token.COMMENT:
+		if i := strings.Index(src[start+2:], "*/"); i >= 0 {
+			end = start + 2 + i + 2
+		}
+	case tok == token.STRING && strings.HasPrefix(lit, "`"):
+		if i := strings.IndexByte(src[start+1:], '`'); i >= 0 {
+			end = start + 1 + i + 1
+		}
+	default:
+		end = start + len(lit)
+	}
+	return end
+}
+
+// keep tells whether the match from start to end is in scope: within one of the
+// regions or, with exclude, overlapping none of them.
+func (r *scopeRegions) keep(start, end int) bool {
+	// The last region starting at or before start, regions never overlapping.
+	i := sort.SearchInts(r.starts, start+1) - 1
+	if !r.exclude {
+		return i >= 0 && start < r.ends[i] && end <= r.ends[i]
+	}
+	if i >= 0 && start < r.ends[i] {
+		return false
+	}
+	// Nor can the match reach into the next region.
+	return i+1 >= len(r.starts) || end <= r.starts[i+1]
+}
+
+// filter returns the spans, found at offset base in the source, that are in scope.
+func (r *scopeRegions) filter(spans [][]int, base int) [][]int {
+	if r == nil {
+		return spans
+	}
+	kept := spans[:0]
+	for _, span := range spans {
+		if r.keep(base+span[0], base+span[1]) {
+			kept = append(kept, span)
+		}
+	}
+	return kept
+}
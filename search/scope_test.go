@@ -0,0 +1,90 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+const scopeSource = `package main
+
+// TODO: count the todo items
+func todo(n int) string {
+	todo := 'T' /* TODO
+	later */
+	return "TODO " + ` + "`todo\r\nraw`" + ` + string(todo)
+}
+`
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		scope Scope
+		want  []string // "line:column" of each match
+	}{
+		{scope: ScopeAll, want: []string{"3:4", "3:20", "4:6", "5:2", "5:17", "7:10", "7:20", "8:15"}},
+		{scope: ScopeComments, want: []string{"3:4", "3:20", "5:17"}},
+		{scope: ScopeStrings, want: []string{"7:10", "7:20"}},
+		{scope: ScopeIdentifiers, want: []string{"4:6", "5:2", "8:15"}},
+		{scope: ScopeCode, want: []string{"4:6", "5:2", "8:15"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope.String(), func(t *testing.T) {
+			s := New(Options{Matcher: Regexp(regexp.MustCompile("(?i)todo")), Scope: tt.scope})
+			var got []string
+			for _, m := range s.Find("main.go", scopeSource) {
+				for i := range m.Spans {
+					line, column := m.Position(i)
+					got = append(got, fmt.Sprintf("%d:%d", line, column))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected matches at %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestScopeCodeSpansRegions(t *testing.T) {
+	// A match reaching into a comment or a string isn't code.
+	s := New(Options{Matcher: Regexp(regexp.MustCompile(`b|:= "a|// c`)), Scope: ScopeCode})
+	matches := s.Find("x.go", "x := \"ab\" // cb\nb\n")
+	if len(matches) != 1 || matches[0].Line != 2 || len(matches[0].Spans) != 1 {
+		t.Errorf("Expected only the b of line 2 to match, got %+v", matches)
+	}
+}
+
+func TestScopeMultiline(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile(`(?s)/\*.*?\*/`)), Multiline: true, Scope: ScopeComments})
+	matches := s.Find("x.go", "a := 1 /* one\ntwo */\nb := \"/* not */\"\n")
+	if len(matches) != 1 || matches[0].Line != 1 || matches[0].EndLine != 2 {
+		t.Errorf("Expected the comment of lines 1-2 only, got %+v", matches)
+	}
+}
+
+func TestScopeFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.go"), []byte("// test\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("// test\n"), 0o644)
+	root := filepath.Join(t.TempDir(), "c.txt")
+	os.WriteFile(root, []byte("// test\n"), 0o644)
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), Scope: ScopeComments})
+	var got []string
+	for m, err := range s.Search(context.Background(), tempDir, root) {
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		got = append(got, filepath.Base(m.Path))
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a.go", "c.txt"}) {
+		t.Errorf("Expected the Go files found and the root given, got %v", got)
+	}
+	if n := s.Stats().Skipped[SkipNotGo]; n != 1 {
+		t.Errorf("Expected b.txt to be reported as not Go source, got %d files", n)
+	}
+}
@@ -0,0 +1,563 @@
+// Package search is gorep's search engine. A Searcher walks directory trees, searches
+// the files it finds with a pool of workers and streams the matching lines back as
+// Match values, leaving it to the caller to present them.
+//
+//	s := search.New(search.Options{Matcher: search.Regexp(regexp.MustCompile(`TODO`))})
+//	for m, err := range s.Search(ctx, "./src") {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Printf("%s:%d: %s\n", m.Path, m.Line, m.Text)
+//	}
+package search
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Options configures a Searcher. Only Matcher is required.
+type Options struct {
+	// Matcher finds the pattern, see NewMatcher.
+	Matcher Matcher
+	// Workers is the number of files searched concurrently, runtime.NumCPU() when < 1.
+	Workers int
+	// Multiline matches the pattern against whole files instead of line by line, so
+	// matches can span lines. The Matcher should be built with Multiline too.
+	Multiline bool
+	// MaxCount stops searching a file after this many Match values (0 means no limit).
+	MaxCount int
+	// MaxTotal stops the whole search after this many Match values (0 means no limit).
+	// The limit is shared by all the searches run by the Searcher.
+	MaxTotal int
+	// Submatches adds the bounds of capture groups to Match.Spans.
+	Submatches bool
+	// Ignore skips files and directories whose name matches one of these globs.
+	Ignore []string
+	// MaxFileSize skips files larger than this many bytes (0 means no limit).
+	MaxFileSize int64
+	// Exclude lists absolute paths to leave out of the search, reported as SkipExcluded.
+	Exclude []string
+	// Scope restricts the matches to some syntactic regions of Go source. The files found
+	// in directories are then only searched if they end with .go, the roots given are
+	// taken for Go source whatever their name.
+	Scope Scope
+	// Index, when set, lets the search of a directory it covers leave out the files it
+	// holds, unchanged, that can't match.
+	Index *Index
+	// OnSkip, when set, is told about every file or directory that isn't searched; err
+	// is nil when the reason says it all. It is called from several goroutines at once.
+	OnSkip func(path string, reason SkipReason, err error)
+}
+
+// Match is a line matching the pattern or, with Options.Multiline, a run of lines
+// covered by matches that share lines.
+type Match struct {
+	// Path is the file the match was found in: a root, or a file found under one.
+	Path string
+	// Line and EndLine are the 1-based numbers of the first and last lines of Text.
+	// They only differ for multiline matches.
+	Line, EndLine int
+	// Column is the 1-based column, counted in characters, where the first match starts.
+	Column int
+	// Offset is the byte offset of Text from the start of the file.
+	Offset int64
+	// Text holds the matching lines, without the line terminator of the last one.
+	Text string
+	// Spans holds the start and end in Text of each match, followed with
+	// Options.Submatches by the bounds of each capture group (-1 for groups that didn't
+	// participate), like regexp's FindAllStringSubmatchIndex.
+	Spans [][]int
+}
+
+// Position returns the line number and the 1-based column, counted in characters, at
+// which the i-th span of m starts.
+func (m Match) Position(i int) (line, column int) {
+	before := m.Text[:m.Spans[i][0]]
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return m.Line + strings.Count(before, "\n"), utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// Stats counts the work done by a Searcher.
+type Stats struct {
+	FilesWalked   int64
+	FilesSearched int64
+	// FilesPruned counts the files Options.Index ruled out without reading them.
+	FilesPruned int64
+	BytesRead   int64
+	// Matches counts every match, MatchedLines the Match values holding them.
+	Matches      int64
+	MatchedLines int64
+	Skipped      map[SkipReason]int64
+	// Time spent in each phase, summed over all goroutines.
+	WalkTime  time.Duration
+	ReadTime  time.Duration
+	MatchTime time.Duration
+}
+
+// searchStats holds the counters behind Stats, updated concurrently by the walker and
+// the workers.
+type searchStats struct {
+	filesWalked   atomic.Int64
+	filesSearched atomic.Int64
+	filesPruned   atomic.Int64
+	bytesRead     atomic.Int64
+	matches       atomic.Int64
+	matchedLines  atomic.Int64
+	skipped       [numSkipReasons]atomic.Int64
+	// In nanoseconds.
+	walkTime  atomic.Int64
+	readTime  atomic.Int64
+	matchTime atomic.Int64
+}
+
+// since adds the time elapsed since start to the phase counter d.
+func since(d *atomic.Int64, start time.Time) {
+	d.Add(int64(time.Since(start)))
+}
+
+// Searcher runs searches. It is safe for concurrent use, its counters and MaxTotal
+// being shared by all of its searches.
+type Searcher struct {
+	opts  Options
+	stats searchStats
+}
+
+// New returns a Searcher running searches with the given options.
+func New(opts Options) *Searcher {
+	if opts.Workers < 1 {
+		opts.Workers = runtime.NumCPU()
+	}
+	return &Searcher{opts: opts}
+}
+
+// Stats returns the counters of all the searches run so far.
+func (s *Searcher) Stats() Stats {
+	st := Stats{
+		FilesWalked:   s.stats.filesWalked.Load(),
+		FilesSearched: s.stats.filesSearched.Load(),
+		FilesPruned:   s.stats.filesPruned.Load(),
+		BytesRead:     s.stats.bytesRead.Load(),
+		Matches:       s.stats.matches.Load(),
+		MatchedLines:  s.stats.matchedLines.Load(),
+		Skipped:       make(map[SkipReason]int64),
+		WalkTime:      time.Duration(s.stats.walkTime.Load()),
+		ReadTime:      time.Duration(s.stats.readTime.Load()),
+		MatchTime:     time.Duration(s.stats.matchTime.Load()),
+	}
+	for r := range numSkipReasons {
+		if n := s.stats.skipped[r].Load(); n > 0 {
+			st.Skipped[r] = n
+		}
+	}
+	return st
+}
+
+// fileResult is what a worker found in a file, or an error about a root.
+type fileResult struct {
+	matches []Match
+	err     error
+}
+
+// Search searches the roots, files or directories walked recursively, and yields the
+// matches as they are found. The matches of a file come together and in order, but
+// files come in no particular order. Roots are never ignored nor skipped for their
+// size. A root that can't be opened yields an error and the search goes on; problems
+// with the files found under a root are reported to Options.OnSkip instead.
+//
+// Stopping the iteration, canceling ctx or reaching MaxTotal stops the search.
+func (s *Searcher) Search(ctx context.Context, roots ...string) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := make(chan fileResult, s.opts.Workers*2)
+		go s.run(ctx, cancel, roots, results)
+		for result := range results {
+			if !yieldResult(result, yield) {
+				cancel()
+				// Let the walker and the workers wind down.
+				for range results {
+				}
+				return
+			}
+		}
+	}
+}
+
+func yieldResult(result fileResult, yield func(Match, error) bool) bool {
+	if result.err != nil {
+		return yield(Match{}, result.err)
+	}
+	for _, m := range result.matches {
+		if !yield(m, nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// run walks the roots and feeds the files to a pool of workers, closing results once
+// they're all done.
+func (s *Searcher) run(ctx context.Context, cancel context.CancelFunc, roots []string, results chan<- fileResult) {
+	defer close(results)
+
+	jobs := make(chan string, s.opts.Workers*2)
+	var wg sync.WaitGroup
+	for range s.opts.Workers {
+		wg.Add(1)
+		go s.worker(ctx, cancel, jobs, results, &wg)
+	}
+
+	s.walk(ctx, roots, jobs, results)
+	close(jobs)
+	wg.Wait()
+}
+
+// walk sends the files to search to jobs, the roots themselves when they aren't
+// directories.
+func (s *Searcher) walk(ctx context.Context, roots []string, jobs chan<- string, results chan<- fileResult) {
+	walkStart := time.Now()
+	var sendTime time.Duration // spent waiting on the workers, not walking
+	defer func() { s.stats.walkTime.Add(int64(time.Since(walkStart) - sendTime)) }()
+
+	send := func(path string) error {
+		sendStart := time.Now()
+		select {
+		case jobs <- path:
+			sendTime += time.Since(sendStart)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	s.walkRoots(ctx, roots, send, func(err error) { results <- fileResult{err: err} })
+}
+
+// walkRoots calls send with the files to search, the roots themselves when they aren't
+// directories, and onError for the roots that can't be opened. It stops at the first
+// error send returns, and returns it.
+func (s *Searcher) walkRoots(ctx context.Context, roots []string, send func(string) error, onError func(error)) error {
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			onError(err)
+			continue
+		}
+		if !info.IsDir() {
+			s.stats.filesWalked.Add(1)
+			err = send(root)
+		} else {
+			err = s.walkDir(ctx, root, send)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errStopped ends a walk whose iteration was stopped.
+var errStopped = errors.New("iteration stopped")
+
+// Files yields the files Search would read for the roots, without reading them: the
+// roots that aren't directories and the files found under the others that the options
+// don't leave out. Binary files are only detected when read, so they are included. A
+// root that can't be opened yields an error and the walk goes on.
+func (s *Searcher) Files(ctx context.Context, roots ...string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		stopped := false
+		send := func(path string) error {
+			if stopped || !yield(path, nil) {
+				stopped = true
+				return errStopped
+			}
+			return nil
+		}
+		s.walkRoots(ctx, roots, send, func(err error) {
+			if !stopped && !yield("", err) {
+				stopped = true
+			}
+		})
+	}
+}
+
+// walkDir sends the files found under the directory root, minus the excluded, ignored
+// and oversized ones, the index files, those the index rules out and, with a Scope, the
+// ones that aren't Go source.
+func (s *Searcher) walkDir(ctx context.Context, root string, send func(string) error) error {
+	var absRoot string
+	if len(s.opts.Exclude) > 0 {
+		var err error
+		if absRoot, err = filepath.Abs(root); err != nil {
+			return err
+		}
+	}
+
+	prune := s.pruner(root)
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			s.skip(path, readSkipReason(err), err)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if absRoot != "" {
+			rel, _ := filepath.Rel(root, path)
+			if slices.Contains(s.opts.Exclude, filepath.Join(absRoot, rel)) {
+				s.skip(path, SkipExcluded, nil)
+				return nil
+			}
+		}
+
+		if path != root && s.Ignored(d.Name()) {
+			s.skip(path, SkipIgnored, nil)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() || !s.walkable(path) {
+			return nil
+		}
+		s.stats.filesWalked.Add(1)
+
+		if s.tooLarge(path, d.Info) {
+			return nil
+		}
+		if prune != nil && prune(path, d) {
+			s.stats.filesPruned.Add(1)
+			return nil
+		}
+		return send(path)
+	})
+}
+
+// walkable tells whether a file found by walkDir is worth counting at all: it isn't an
+// index file and, with a Scope, it is Go source. Other files are reported.
+func (s *Searcher) walkable(path string) bool {
+	switch {
+	case filepath.Base(path) == IndexFile:
+		s.skip(path, SkipIndexFile, nil)
+		return false
+	case s.opts.Scope != ScopeAll && filepath.Ext(path) != ".go":
+		s.skip(path, SkipNotGo, nil)
+		return false
+	}
+	return true
+}
+
+// tooLarge tells whether the file at path is over MaxFileSize, reporting it if so. info
+// is only called when there is a limit.
+func (s *Searcher) tooLarge(path string, info func() (fs.FileInfo, error)) bool {
+	if s.opts.MaxFileSize <= 0 {
+		return false
+	}
+	if info, err := info(); err == nil && info.Size() > s.opts.MaxFileSize {
+		s.skip(path, SkipTooLarge, nil)
+		return true
+	}
+	return false
+}
+
+// Wanted tells whether the search of a directory holding the file at path would search
+// it, rather than leave it out for being excluded, ignored, an index file, too large or,
+// with a Scope, not Go source. Unlike the roots given to Search, which are always
+// searched, files checked this way are treated like the ones found walking, and
+// reported to Options.OnSkip alike.
+func (s *Searcher) Wanted(path string) bool {
+	if len(s.opts.Exclude) > 0 {
+		if abs, err := filepath.Abs(path); err == nil && slices.Contains(s.opts.Exclude, abs) {
+			s.skip(path, SkipExcluded, nil)
+			return false
+		}
+	}
+	if s.Ignored(filepath.Base(path)) {
+		s.skip(path, SkipIgnored, nil)
+		return false
+	}
+	if !s.walkable(path) {
+		return false
+	}
+	return !s.tooLarge(path, func() (fs.FileInfo, error) { return os.Stat(path) })
+}
+
+func (s *Searcher) worker(ctx context.Context, cancel context.CancelFunc, jobs <-chan string, results chan<- fileResult, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for path := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		if matches := s.searchFile(path, cancel); len(matches) > 0 {
+			// Always delivered: Search drains results even once canceled, and matches
+			// counted towards MaxTotal must be seen.
+			results <- fileResult{matches: matches}
+		}
+	}
+}
+
+// searchFile reads and searches the file at path, unless it turns out to be binary.
+func (s *Searcher) searchFile(path string, cancel context.CancelFunc) []Match {
+	readStart := time.Now()
+	content, err := os.ReadFile(path)
+	since(&s.stats.readTime, readStart)
+	if err != nil {
+		s.skip(path, readSkipReason(err), err)
+		return nil
+	}
+	s.stats.bytesRead.Add(int64(len(content)))
+	if !utf8.Valid(content) {
+		s.skip(path, SkipBinary, nil)
+		return nil
+	}
+	s.stats.filesSearched.Add(1)
+	text := string(content)
+	if !mayMatch(s.opts.Matcher, text) {
+		return nil
+	}
+
+	matchStart := time.Now()
+	defer since(&s.stats.matchTime, matchStart)
+	return s.find(path, text, cancel)
+}
+
+// SearchReader searches what r holds, reporting name as the Path of the matches. Lines
+// are matched as they are read, whatever their length, so that the matches of an input
+// that keeps growing, like a log followed with tail -f, come as soon as their line is
+// complete. With Options.Multiline or Options.Scope the whole of r is read first, as
+// matches, comments and strings can span lines, r being taken for Go source with the
+// latter. Once ctx is canceled it returns without waiting for a pending Read of r.
+func (s *Searcher) SearchReader(ctx context.Context, name string, r io.Reader) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		if s.opts.Multiline || s.opts.Scope != ScopeAll {
+			readStart := time.Now()
+			content, err := io.ReadAll(r)
+			since(&s.stats.readTime, readStart)
+			if err != nil {
+				yield(Match{}, err)
+				return
+			}
+			s.stats.bytesRead.Add(int64(len(content)))
+			for _, m := range s.Find(name, string(content)) {
+				if ctx.Err() != nil || !yield(m, nil) {
+					return
+				}
+			}
+			return
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		lines := make(chan readLine)
+		go s.readLines(ctx, r, lines)
+		lineNum, count := 0, 0
+		var offset int64
+		for {
+			var l readLine
+			select {
+			case <-ctx.Done():
+				return
+			case l = <-lines:
+			}
+			if l.err != nil {
+				if l.err != io.EOF {
+					yield(Match{}, l.err)
+				}
+				return
+			}
+			s.stats.bytesRead.Add(int64(len(l.text)))
+			lineNum++
+			matchStart := time.Now()
+			m, ok := s.matchLine(name, l.text, lineNum, offset, nil)
+			since(&s.stats.matchTime, matchStart)
+			offset += int64(len(l.text))
+			if !ok {
+				continue
+			}
+			// takeMatch cancels ctx once MaxTotal is reached, which ends the loop.
+			if !s.takeMatch(cancel) {
+				return
+			}
+			s.stats.matches.Add(int64(len(m.Spans)))
+			count++
+			if !yield(m, nil) || count == s.opts.MaxCount {
+				return
+			}
+		}
+	}
+}
+
+// readLine is a line read by readLines, with its terminator, or the error that ended
+// the reading: io.EOF at the end of the input.
+type readLine struct {
+	text string
+	err  error
+}
+
+// readLines sends the lines of r to lines until its end, or an error, is sent or ctx is
+// canceled.
+func (s *Searcher) readLines(ctx context.Context, r io.Reader, lines chan<- readLine) {
+	br := bufio.NewReader(r)
+	for {
+		readStart := time.Now()
+		line, err := br.ReadString('\n')
+		since(&s.stats.readTime, readStart)
+		if line != "" {
+			select {
+			case lines <- readLine{text: line}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			select {
+			case lines <- readLine{err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+	}
+}
+
+// Find returns the matches in text, reporting name as their Path.
+func (s *Searcher) Find(name string, text string) []Match {
+	matchStart := time.Now()
+	defer since(&s.stats.matchTime, matchStart)
+	return s.find(name, text, nil)
+}
+
+// takeMatch counts one more Match towards MaxTotal. It reports false once the limit has
+// been reached, and calls cancel, if not nil, as soon as it is.
+func (s *Searcher) takeMatch(cancel context.CancelFunc) bool {
+	n := s.stats.matchedLines.Add(1)
+	if s.opts.MaxTotal <= 0 {
+		return true
+	}
+	if n >= int64(s.opts.MaxTotal) && cancel != nil {
+		cancel()
+	}
+	if n > int64(s.opts.MaxTotal) {
+		s.stats.matchedLines.Add(-1)
+		return false
+	}
+	return true
+}
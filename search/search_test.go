@@ -0,0 +1,350 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a test\nno\ntest test\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("nothing\n"), 0o644)
+	single := filepath.Join(t.TempDir(), "c.txt")
+	os.WriteFile(single, []byte("one test\n"), 0o644)
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), Workers: 2})
+	var got []string
+	for m, err := range s.Search(context.Background(), tempDir, single) {
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s:%d:%d:%q:%v", filepath.Base(m.Path), m.Line, m.Column, m.Text, m.Spans))
+	}
+	slices.Sort(got)
+	want := []string{
+		`a.txt:1:3:"a test":[[2 6]]`,
+		`a.txt:3:1:"test test":[[0 4] [5 9]]`,
+		`c.txt:1:5:"one test":[[4 8]]`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	st := s.Stats()
+	if st.FilesWalked != 3 || st.FilesSearched != 3 || st.Matches != 4 || st.MatchedLines != 3 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
+
+func TestSearchKeepsFilesTogether(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		os.WriteFile(fmt.Sprintf("%s/file%d.txt", tempDir, i), []byte(strings.Repeat("test\n", 10)), 0o644)
+	}
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), Workers: 4})
+	seen := map[string]bool{}
+	last, line := "", 0
+	for m, err := range s.Search(context.Background(), tempDir) {
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if m.Path != last {
+			if seen[m.Path] {
+				t.Fatalf("Matches of %s aren't together", m.Path)
+			}
+			seen[m.Path], last, line = true, m.Path, 0
+		}
+		if m.Line != line+1 {
+			t.Fatalf("Expected line %d of %s, got %d", line+1, m.Path, m.Line)
+		}
+		line = m.Line
+	}
+	if len(seen) != 20 {
+		t.Errorf("Expected matches in 20 files, got %d", len(seen))
+	}
+}
+
+func TestSearchRootErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test\n"), 0o644)
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test"))})
+	var matches, errs int
+	for _, err := range s.Search(context.Background(), filepath.Join(tempDir, "missing"), tempDir) {
+		if err != nil {
+			errs++
+		} else {
+			matches++
+		}
+	}
+	if errs != 1 || matches != 1 {
+		t.Errorf("Expected 1 error and 1 match, got %d and %d", errs, matches)
+	}
+}
+
+func TestSearchStopsEarly(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 100; i++ {
+		os.WriteFile(fmt.Sprintf("%s/file%d.txt", tempDir, i), []byte("test one\ntest two\n"), 0o644)
+	}
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), Workers: 2})
+	for range s.Search(context.Background(), tempDir) {
+		break
+	}
+	if n := s.Stats().FilesSearched; n >= 100 {
+		t.Errorf("Expected the search to stop early, %d files were searched", n)
+	}
+
+	s = New(Options{Matcher: Regexp(regexp.MustCompile("test")), Workers: 4, MaxTotal: 5})
+	n := 0
+	for range s.Search(context.Background(), tempDir) {
+		n++
+	}
+	if n != 5 {
+		t.Errorf("Expected 5 matches in total, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s = New(Options{Matcher: Regexp(regexp.MustCompile("test"))})
+	for range s.Search(ctx, tempDir) {
+		t.Fatal("Expected nothing from a canceled search")
+	}
+}
+
+func TestSearchExclude(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "out.txt"), []byte("test\n"), 0o644)
+	t.Chdir(tempDir)
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), Exclude: []string{filepath.Join(tempDir, "out.txt")}})
+	var paths []string
+	for m, err := range s.Search(context.Background(), ".") {
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		paths = append(paths, m.Path)
+	}
+	if !slices.Equal(paths, []string{"a.txt"}) {
+		t.Errorf("Expected only a.txt, relative to the root, got %v", paths)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.bin"), []byte{0xff}, 0o644)
+	os.WriteFile(filepath.Join(tempDir, "big.txt"), []byte("too large"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "vendor"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "vendor", "c.txt"), []byte("c"), 0o644)
+	single := filepath.Join(t.TempDir(), "d.txt")
+	os.WriteFile(single, []byte("d"), 0o644)
+
+	s := New(Options{Ignore: []string{"vendor"}, MaxFileSize: 4})
+	var got []string
+	var errs int
+	for path, err := range s.Files(context.Background(), tempDir, filepath.Join(tempDir, "missing"), single) {
+		if err != nil {
+			errs++
+			continue
+		}
+		got = append(got, filepath.Base(path))
+	}
+	if want := []string{"a.txt", "b.bin", "d.txt"}; !slices.Equal(got, want) || errs != 1 {
+		t.Errorf("Expected %v and an error for the missing root, got %v and %d errors", want, got, errs)
+	}
+	if st := s.Stats(); st.FilesSearched != 0 || st.BytesRead != 0 {
+		t.Errorf("Expected no file to be read, got %+v", st)
+	}
+
+	n := 0
+	for range s.Files(context.Background(), tempDir, single) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("Expected the walk to stop with the iteration, got %d paths", n)
+	}
+}
+
+func TestSearchReader(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test"))})
+	var lines []int
+	for m, err := range s.SearchReader(context.Background(), "stdin", strings.NewReader("test\nno\na test\n")) {
+		if err != nil {
+			t.Fatalf("SearchReader failed: %v", err)
+		}
+		if m.Path != "stdin" {
+			t.Errorf("Expected the given name as path, got %q", m.Path)
+		}
+		lines = append(lines, m.Line)
+	}
+	if !slices.Equal(lines, []int{1, 3}) {
+		t.Errorf("Expected lines 1 and 3, got %v", lines)
+	}
+	if n := s.Stats().BytesRead; n != 15 {
+		t.Errorf("Expected 15 bytes read, got %d", n)
+	}
+}
+
+func TestSearchReaderStreams(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("ERROR"))})
+	next, stop := iter.Pull2(s.SearchReader(context.Background(), "stdin", r))
+	defer stop()
+
+	// Each match comes as soon as its line is complete, while more input is awaited.
+	go io.WriteString(w, "ok\nan ERROR\nstill")
+	if m, err, ok := next(); !ok || err != nil || m.Line != 2 || m.Text != "an ERROR" {
+		t.Fatalf("Expected the match of line 2, got %+v (%v)", m, err)
+	}
+	long := strings.Repeat("x", 100_000) + "ERROR\n"
+	go io.WriteString(w, " going\n"+long)
+	if m, err, ok := next(); !ok || err != nil || m.Line != 4 || m.Column != 100_001 || m.Offset != 24 {
+		t.Fatalf("Expected the match of the long line 4, got line %d column %d (%v)", m.Line, m.Column, err)
+	}
+}
+
+func TestSearchReaderStops(t *testing.T) {
+	// Neither a limit being reached nor ctx being canceled waits for more input.
+	r, w := io.Pipe()
+	defer w.Close()
+	go io.WriteString(w, "test\ntest\n")
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), MaxCount: 1})
+	n := 0
+	for range s.SearchReader(context.Background(), "stdin", r) {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Expected a single match with MaxCount 1, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s = New(Options{Matcher: Regexp(regexp.MustCompile("test"))})
+	time.AfterFunc(50*time.Millisecond, cancel)
+	for m := range s.SearchReader(ctx, "stdin", r) {
+		t.Errorf("Unexpected match %+v", m)
+	}
+
+	s = New(Options{Matcher: Regexp(regexp.MustCompile("test")), MaxTotal: 1})
+	r, w = io.Pipe()
+	defer w.Close()
+	go io.WriteString(w, "test\n")
+	for range s.SearchReader(context.Background(), "stdin", r) {
+	}
+	if n := s.Stats().MatchedLines; n != 1 {
+		t.Errorf("Expected a single match with MaxTotal 1, got %d", n)
+	}
+}
+
+func TestSearchReaderError(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test"))})
+	r := io.MultiReader(strings.NewReader("test\n"), iotest.ErrReader(errors.New("broken")))
+	var lines []int
+	var err error
+	for m, e := range s.SearchReader(context.Background(), "stdin", r) {
+		if e != nil {
+			err = e
+			break
+		}
+		lines = append(lines, m.Line)
+	}
+	if !slices.Equal(lines, []int{1}) || err == nil || err.Error() != "broken" {
+		t.Errorf("Expected line 1 then the read error, got %v and %v", lines, err)
+	}
+}
+
+func TestTakeMatchCancelsSearch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), MaxTotal: 2})
+	if !s.takeMatch(cancel) || ctx.Err() != nil {
+		t.Fatal("First match should be taken without canceling")
+	}
+	if !s.takeMatch(cancel) {
+		t.Fatal("Second match should be taken")
+	}
+	if ctx.Err() == nil {
+		t.Error("Reaching MaxTotal should cancel the search")
+	}
+	if s.takeMatch(cancel) {
+		t.Error("Matches beyond MaxTotal should be refused")
+	}
+	if n := s.Stats().MatchedLines; n != 2 {
+		t.Errorf("Expected refused matches not to be counted, got %d", n)
+	}
+}
+
+func TestWorkerWithContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	jobs := make(chan string, 1)
+	results := make(chan fileResult, 1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test"))})
+
+	// Start worker
+	go s.worker(ctx, cancel, jobs, results, &wg)
+
+	// Cancel context before sending jobs
+	cancel()
+	close(jobs)
+
+	wg.Wait()
+	close(results)
+
+	// Should complete without hanging
+}
+
+func TestWorkerSelectsContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	jobs := make(chan string, 10)
+	results := make(chan fileResult, 10)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test"))})
+
+	// Start worker
+	go s.worker(ctx, cancel, jobs, results, &wg)
+
+	// Send a job then cancel
+	tempFile := filepath.Join(t.TempDir(), "test.txt")
+	os.WriteFile(tempFile, []byte("test content"), 0o644)
+
+	jobs <- tempFile
+
+	// Cancel context
+	cancel()
+	close(jobs)
+
+	wg.Wait()
+	close(results)
+
+	// Drain results
+	for range results {
+	}
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+)
+
+// SkipReason tells why a file or directory found while walking wasn't searched.
+type SkipReason int
+
+const (
+	SkipPermission SkipReason = iota
+	SkipUnreadable
+	SkipBinary
+	SkipTooLarge
+	SkipIgnored
+	// SkipExcluded is for the paths of Options.Exclude.
+	SkipExcluded
+	// SkipIndexFile is for the files Options.Index, or gorep index build, writes.
+	SkipIndexFile
+	// SkipNotGo is for the files that aren't Go source, with Options.Scope.
+	SkipNotGo
+	numSkipReasons
+)
+
+func (r SkipReason) String() string {
+	switch r {
+	case SkipPermission:
+		return "permission denied"
+	case SkipUnreadable:
+		return "unreadable"
+	case SkipBinary:
+		return "binary"
+	case SkipTooLarge:
+		return "too large"
+	case SkipIgnored:
+		return "ignored"
+	case SkipExcluded:
+		return "excluded"
+	case SkipIndexFile:
+		return "index file"
+	case SkipNotGo:
+		return "not Go source"
+	default:
+		return "SkipReason(" + strconv.Itoa(int(r)) + ")"
+	}
+}
+
+// IsError tells whether the file or directory was skipped because it couldn't be read,
+// which leaves the search incomplete, rather than on purpose.
+func (r SkipReason) IsError() bool {
+	return r == SkipPermission || r == SkipUnreadable
+}
+
+// readSkipReason classifies the error from reading a file or directory.
+func readSkipReason(err error) SkipReason {
+	if errors.Is(err, fs.ErrPermission) {
+		return SkipPermission
+	}
+	return SkipUnreadable
+}
+
+// skip counts path as skipped and reports it to Options.OnSkip.
+func (s *Searcher) skip(path string, reason SkipReason, err error) {
+	s.stats.skipped[reason].Add(1)
+	if s.opts.OnSkip != nil {
+		s.opts.OnSkip(path, reason, err)
+	}
+}
+
+// Ignored tells whether a file or directory name matches one of the Ignore patterns.
+func (s *Searcher) Ignored(name string) bool {
+	_, ok := s.IgnorePattern(name)
+	return ok
+}
+
+// IgnorePattern returns the first of the Ignore patterns a file or directory name
+// matches, if any.
+func (s *Searcher) IgnorePattern(name string) (string, bool) {
+	for _, pattern := range s.opts.Ignore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
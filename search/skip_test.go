@@ -0,0 +1,147 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestSkipReasonString(t *testing.T) {
+	tests := []struct {
+		reason SkipReason
+		want   string
+	}{
+		{SkipPermission, "permission denied"},
+		{SkipUnreadable, "unreadable"},
+		{SkipBinary, "binary"},
+		{SkipTooLarge, "too large"},
+		{SkipIgnored, "ignored"},
+		{SkipExcluded, "excluded"},
+		{SkipIndexFile, "index file"},
+		{SkipNotGo, "not Go source"},
+		{numSkipReasons, "SkipReason(8)"},
+	}
+	for _, tt := range tests {
+		if got := tt.reason.String(); got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+	if !SkipUnreadable.IsError() || SkipBinary.IsError() {
+		t.Error("Only read failures should be errors")
+	}
+}
+
+func TestReadSkipReason(t *testing.T) {
+	if r := readSkipReason(&fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}); r != SkipPermission {
+		t.Errorf("Expected permission denied, got %v", r)
+	}
+	if r := readSkipReason(errors.New("boom")); r != SkipUnreadable {
+		t.Errorf("Expected unreadable, got %v", r)
+	}
+}
+
+func TestOnSkip(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.bin"), []byte{0xFF, 't', 'e', 's', 't'}, 0o644)
+	os.WriteFile(filepath.Join(tempDir, "big.txt"), make([]byte, 100), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "vendor"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "vendor", "c.txt"), []byte("test\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "out.txt"), []byte("test\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, IndexFile), []byte("test\n"), 0o644)
+
+	var mu sync.Mutex
+	skipped := map[string]SkipReason{}
+	s := New(Options{
+		Matcher:     Regexp(regexp.MustCompile("test")),
+		Workers:     2,
+		Ignore:      []string{"vendor"},
+		MaxFileSize: 50,
+		Exclude:     []string{filepath.Join(tempDir, "out.txt")},
+		OnSkip: func(path string, reason SkipReason, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			skipped[filepath.Base(path)] = reason
+		},
+	})
+	n := 0
+	for _, err := range s.Search(context.Background(), tempDir) {
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Expected a single match, got %d", n)
+	}
+
+	want := map[string]SkipReason{
+		"b.bin":   SkipBinary,
+		"big.txt": SkipTooLarge,
+		"vendor":  SkipIgnored,
+		"out.txt": SkipExcluded,
+		IndexFile: SkipIndexFile,
+	}
+	if len(skipped) != len(want) {
+		t.Errorf("Expected skips %v, got %v", want, skipped)
+	}
+	for name, reason := range want {
+		if skipped[name] != reason {
+			t.Errorf("Expected %s to be skipped as %s, got %s", name, reason, skipped[name])
+		}
+	}
+	if st := s.Stats(); st.Skipped[SkipBinary] != 1 || st.FilesWalked != 3 || st.FilesSearched != 1 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
+
+func TestIgnorePattern(t *testing.T) {
+	s := New(Options{Matcher: Regexp(regexp.MustCompile("test")), Ignore: []string{"*.min.js", "vendor"}})
+	if pattern, ok := s.IgnorePattern("app.min.js"); !ok || pattern != "*.min.js" {
+		t.Errorf("Expected app.min.js to be ignored by *.min.js, got %q", pattern)
+	}
+	if _, ok := s.IgnorePattern("app.js"); ok || s.Ignored("app.js") {
+		t.Error("Expected app.js not to be ignored")
+	}
+}
+
+func TestWanted(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name string, size int) string {
+		path := filepath.Join(tempDir, name)
+		os.WriteFile(path, make([]byte, size), 0o644)
+		return path
+	}
+	out := write("out.go", 1)
+	s := New(Options{
+		Matcher:     Regexp(regexp.MustCompile("x")),
+		Ignore:      []string{"*.log"},
+		MaxFileSize: 10,
+		Scope:       ScopeCode,
+		Exclude:     []string{out},
+	})
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{write("a.go", 5), true},
+		{write("big.go", 20), false},
+		{write("a.txt", 5), false},
+		{write("a.log", 5), false},
+		{write(IndexFile, 5), false},
+		{out, false},
+	}
+	for _, tt := range tests {
+		if got := s.Wanted(tt.path); got != tt.want {
+			t.Errorf("Wanted(%s) = %v, want %v", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+	if st := s.Stats(); st.Skipped[SkipTooLarge] != 1 || st.Skipped[SkipIgnored] != 1 {
+		t.Errorf("Expected the too large and ignored files to be reported, got %v", st.Skipped)
+	}
+}
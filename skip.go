@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+// skip reports that path wasn't searched, see search.Options.OnSkip. Unless -s is given,
+// a warning is printed (except for files left out on purpose: with -ignore or -in,
+// gorep's own output and index files) and read errors make the search fail. -debug
+// reports every file, with -s too.
+func (c *config) skip(path string, reason search.SkipReason, err error) {
+	if reason.IsError() && !c.noMessages {
+		c.failed.Store(true)
+	}
+	switch {
+	case c.noMessages && !c.debug:
+	case reason == search.SkipIgnored && c.debug:
+		pattern, _ := c.searcher().IgnorePattern(filepath.Base(path))
+		log.Printf("skipping %s (%s by -ignore %s)\n", path, reason, pattern)
+	case reason == search.SkipTooLarge && c.debug:
+		log.Printf("skipping %s (%s, over -max-filesize %d bytes)\n", path, reason, c.maxFileSize)
+	case reason == search.SkipExcluded && c.debug:
+		log.Printf("skipping %s (%s, the -o output file)\n", path, reason)
+	case reason == search.SkipNotGo && c.debug:
+		log.Printf("skipping %s (%s, for -in %s)\n", path, reason, c.scope)
+	case onPurpose(reason) && !c.debug:
+	case err != nil:
+		log.Printf("skipping %s (%s): %v\n", path, reason, err)
+	default:
+		log.Printf("skipping %s (%s)\n", path, reason)
+	}
+}
+
+// onPurpose tells whether files skipped for reason are left out on purpose, which isn't
+// worth a warning.
+func onPurpose(reason search.SkipReason) bool {
+	switch reason {
+	case search.SkipIgnored, search.SkipExcluded, search.SkipIndexFile, search.SkipNotGo:
+		return true
+	}
+	return false
+}
+
+// summarized are the reasons skipSummary counts. What gorep leaves out of its own accord,
+// like its index files, isn't worth a mention.
+var summarized = []search.SkipReason{
+	search.SkipPermission,
+	search.SkipUnreadable,
+	search.SkipBinary,
+	search.SkipTooLarge,
+	search.SkipIgnored,
+}
+
+// skipSummary describes how many files were skipped for each reason, e.g.
+// "skipped 3 files: 1 permission denied, 2 binary", or returns "" if none were.
+func (c *config) skipSummary() string {
+	skipped := c.searcher().Stats().Skipped
+	var total int64
+	var parts []string
+	for _, r := range summarized {
+		n := skipped[r]
+		if n == 0 {
+			continue
+		}
+		total += n
+		parts = append(parts, fmt.Sprintf("%d %s", n, r))
+	}
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("skipped %s: %s", count(total, "file", "files"), strings.Join(parts, ", "))
+}
+
+// addSkipFlags defines the flags selecting files to leave out of directory searches,
+// -ignore and -max-filesize.
+func addSkipFlags(fs *flag.FlagSet, ignore *[]string, maxFileSize *int64) {
+	fs.Func("ignore", "skip files and directories whose name matches this glob (can be repeated)", func(s string) error {
+		if _, err := filepath.Match(s, ""); err != nil {
+			return err
+		}
+		*ignore = append(*ignore, s)
+		return nil
+	})
+	fs.Func("max-filesize", "skip files larger than this many bytes (K, M and G suffixes allowed)", func(s string) error {
+		var err error
+		*maxFileSize, err = parseSize(s)
+		return err
+	})
+}
+
+// parseSize parses a -max-filesize value: a number of bytes with an optional K, M or G
+// suffix (powers of 1024).
+func parseSize(s string) (int64, error) {
+	number, multiplier := s, int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			number, multiplier = n, m
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestSkipSummary(t *testing.T) {
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
+	if s := c.skipSummary(); s != "" {
+		t.Errorf("Expected no summary, got %q", s)
+	}
+
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.bin"), []byte{0xFF}, 0o644)
+	c.searchDirectory(context.Background(), tempDir, nil)
+	if s := c.skipSummary(); s != "skipped 1 file: 1 binary" {
+		t.Errorf("Unexpected summary %q", s)
+	}
+	if c.failed.Load() {
+		t.Error("Binary files shouldn't make the search fail")
+	}
+
+	os.WriteFile(filepath.Join(tempDir, "b.log"), []byte("test"), 0o644)
+	c = newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
+	c.ignore = []string{"*.log"}
+	c.searchDirectory(context.Background(), tempDir, nil)
+	if s := c.skipSummary(); s != "skipped 2 files: 1 binary, 1 ignored" {
+		t.Errorf("Unexpected summary %q", s)
+	}
+
+	c.skip("c", search.SkipUnreadable, errors.New("boom"))
+	if !c.failed.Load() {
+		t.Error("Unreadable files should make the search fail")
+	}
+}
+
+func TestSkipDebug(t *testing.T) {
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, "", "", nil, 1)
+	c.ignore = []string{"*.log", "vendor"}
+	c.maxFileSize = 4
+	c.noMessages, c.debug = true, true
+	c.engine = search.New(c.searchOptions())
+	c.skip("dir/b.log", search.SkipIgnored, nil)
+	c.skip("big.txt", search.SkipTooLarge, nil)
+	c.skip("c", search.SkipUnreadable, errors.New("boom"))
+	c.skip("out.txt", search.SkipExcluded, nil)
+	c.skip("dir/"+search.IndexFile, search.SkipIndexFile, nil)
+	c.scope = search.ScopeCode
+	c.skip("README.md", search.SkipNotGo, nil)
+	for _, want := range []string{
+		"skipping dir/b.log (ignored by -ignore *.log)",
+		"skipping big.txt (too large, over -max-filesize 4 bytes)",
+		"skipping c (unreadable): boom",
+		"skipping out.txt (excluded, the -o output file)",
+		"skipping dir/" + search.IndexFile + " (index file)",
+		"skipping README.md (not Go source, for -in code)",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q to be reported, got %q", want, buf.String())
+		}
+	}
+	if c.failed.Load() {
+		t.Error("-debug shouldn't make the search fail with -s")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "100", want: 100},
+		{in: "2K", want: 2048},
+		{in: "3M", want: 3 << 20},
+		{in: "1G", want: 1 << 30},
+		{in: "", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "12X", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q): unexpected error %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q): expected %d, got %d", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestSkippedFilesInDirectorySearch(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "match.txt"), []byte("a test\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "binary.bin"), []byte{0xFF, 0xFE, 't', 'e', 's', 't'}, 0o644)
+	os.WriteFile(filepath.Join(tempDir, "big.txt"), make([]byte, 2048), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "notes.log"), []byte("test\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "vendor"), 0o755)
+	os.WriteFile(filepath.Join(tempDir, "vendor", "dep.txt"), []byte("test\n"), 0o644)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	c, err := ConfigureWithArgs([]string{
+		"gorep", "-f", tempDir, "-o", outputPath,
+		"-ignore", "*.log", "-ignore", "vendor", "-max-filesize", "1K", "test",
+	})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+
+	want := map[search.SkipReason]int64{search.SkipBinary: 1, search.SkipTooLarge: 1, search.SkipIgnored: 2}
+	if got := c.searcher().Stats().Skipped; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected skips %v, got %v", want, got)
+	}
+	content, _ := os.ReadFile(outputPath)
+	if string(content) != "match.txt: \n1. a test\n" {
+		t.Errorf("Expected only match.txt to be searched, got %q", content)
+	}
+}
+
+func TestSkipFlagValidation(t *testing.T) {
+	if _, err := ConfigureWithArgs([]string{"gorep", "-ignore", "[", "test"}); err == nil {
+		t.Error("Expected error for a malformed -ignore glob")
+	}
+	if _, err := ConfigureWithArgs([]string{"gorep", "-max-filesize", "big", "test"}); err == nil {
+		t.Error("Expected error for a malformed -max-filesize")
+	}
+}
+
+func TestSkipPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions aren't enforced for root")
+	}
+	tempDir := t.TempDir()
+	locked := filepath.Join(tempDir, "locked")
+	os.Mkdir(locked, 0o755)
+	os.WriteFile(filepath.Join(tempDir, "secret.txt"), []byte("test"), 0o000)
+	defer os.Chmod(filepath.Join(tempDir, "secret.txt"), 0o644)
+	os.Chmod(locked, 0o000)
+	defer os.Chmod(locked, 0o755)
+
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, "", nil, 1)
+	if got := c.Main(context.Background()); got != 2 {
+		t.Errorf("Expected exit code 2, got %d", got)
+	}
+	if got := c.searcher().Stats().Skipped[search.SkipPermission]; got != 2 {
+		t.Errorf("Expected 2 permission denied skips, got %d", got)
+	}
+}
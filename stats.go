@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+// statsSummary renders the -stats report for a search that took elapsed.
+func (c *config) statsSummary(elapsed time.Duration) string {
+	s := c.searcher().Stats()
+	var skipped int64
+	for r, n := range s.Skipped {
+		// gorep's own files aren't part of what's searched.
+		if r != search.SkipExcluded && r != search.SkipIndexFile {
+			skipped += n
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", count(s.Matches, "match", "matches"))
+	fmt.Fprintf(&b, "%s\n", count(int64(c.matchedLines), "matched line", "matched lines"))
+	fmt.Fprintf(&b, "%s walked\n", count(s.FilesWalked, "file", "files"))
+	fmt.Fprintf(&b, "%s searched\n", count(s.FilesSearched, "file", "files"))
+	fmt.Fprintf(&b, "%s skipped\n", count(skipped, "file", "files"))
+	if c.index != nil {
+		fmt.Fprintf(&b, "%s pruned by the index\n", count(s.FilesPruned, "file", "files"))
+	}
+	fmt.Fprintf(&b, "%s read\n", count(s.BytesRead, "byte", "bytes"))
+	fmt.Fprintf(&b, "%s elapsed\n", elapsed.Round(time.Microsecond))
+	fmt.Fprintf(&b, "%s walking, %s reading, %s matching (summed over workers)\n",
+		s.WalkTime.Round(time.Microsecond),
+		s.ReadTime.Round(time.Microsecond),
+		s.MatchTime.Round(time.Microsecond))
+	return b.String()
+}
+
+// count returns n followed by the singular or the plural noun, whichever fits.
+func count(n int64, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
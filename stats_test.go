@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestStatsDirectorySearch(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test test\nno\ntest\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("nothing here\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "c.bin"), []byte{0xFF, 0xFE}, 0o644)
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-stats", "-s", "-workers", "2", "-f", tempDir, "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !c.showStats {
+		t.Fatal("Expected -stats to be set")
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Fatalf("Expected exit code 0, got %d", got)
+	}
+
+	summary := c.statsSummary(1500 * time.Millisecond)
+	for _, want := range []string{
+		"3 matches\n",
+		"2 matched lines\n",
+		"3 files walked\n",
+		"2 files searched\n",
+		"1 file skipped\n",
+		"33 bytes read\n",
+		"1.5s elapsed\n",
+		"(summed over workers)\n",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Expected stats to contain %q, got:\n%s", want, summary)
+		}
+	}
+}
+
+func TestStatsSingleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(path, []byte("one test\n"), 0o644)
+
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, path, "", nil, 1)
+	c.showStats = true
+	if got := c.Main(context.Background()); got != 0 {
+		t.Fatalf("Expected exit code 0, got %d", got)
+	}
+	if n := c.searcher().Stats().FilesSearched; n != 1 {
+		t.Errorf("Expected 1 file searched, got %d", n)
+	}
+	if n := c.searcher().Stats().BytesRead; n != 9 {
+		t.Errorf("Expected 9 bytes read, got %d", n)
+	}
+}
+
+func TestStatsLeaveOutOwnFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test\n"), 0o644)
+	c, err := ConfigureWithArgs([]string{"gorep", "index", "build", tempDir})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Fatalf("Expected the index to be built, got exit code %d", got)
+	}
+
+	c, err = ConfigureWithArgs([]string{"gorep", "-index", "-stats", "test", tempDir})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 0 {
+		t.Fatalf("Expected exit code 0, got %d", got)
+	}
+	summary := c.statsSummary(time.Second)
+	for _, want := range []string{"1 match\n", "1 matched line\n", "1 file walked\n", "0 files skipped\n", "0 files pruned"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Expected stats to contain %q, got:\n%s", want, summary)
+		}
+	}
+}
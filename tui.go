@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"fortio.org/terminal"
+	"fortio.org/terminal/ansipixels"
+	"github.com/geofpwhite/gorep/search"
+)
+
+const (
+	// tuiFPS is how often -tui checks for keys and new results.
+	tuiFPS = 30
+	// tuiMaxResults caps the matches -tui collects for a pattern: a short pattern typed
+	// on the way to a longer one can match nearly every line of a large tree.
+	tuiMaxResults = 10000
+)
+
+// tui is the state of the interactive view of -tui: the pattern being typed, the
+// matches of the search it started and the one selected. It is only touched by the
+// loop of runTUI, searches send their matches to it through results.
+type tui struct {
+	c     *config
+	roots []string
+
+	pattern string
+	// err tells why the pattern isn't valid, or why the search failed.
+	err       error
+	matches   []search.Match
+	searching bool
+	selected  int
+	// top is the index of the first match shown, rows how many fit in the list.
+	top, rows int
+	chosen    bool
+
+	gen     int
+	cancel  context.CancelFunc
+	results chan tuiResult
+
+	previewPath  string
+	previewLines []string
+	previewErr   error
+}
+
+// tuiResult is a match, or the end of a search when done is set, from the search
+// number gen: results of searches since replaced are dropped.
+type tuiResult struct {
+	gen   int
+	match search.Match
+	err   error
+	done  bool
+}
+
+func newTUI(c *config, pattern string) *tui {
+	roots := c.paths
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	return &tui{c: c, roots: roots, pattern: pattern, rows: 10, results: make(chan tuiResult, 256)}
+}
+
+// runTUI runs the interactive view until it's quit. Pressing enter quits too, printing
+// the position of the selected match.
+func (c *config) runTUI(ctx context.Context, pattern string) error {
+	ap := ansipixels.NewAnsiPixels(tuiFPS)
+	ap.AutoLoggerSetup = false
+	if err := ap.Open(); err != nil {
+		return fmt.Errorf("-tui needs a terminal: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t := newTUI(c, pattern)
+	t.setPattern(ctx, pattern)
+	ap.OnResize = func() error {
+		ap.StartSyncMode()
+		t.draw(ap)
+		ap.EndSyncMode()
+		return nil
+	}
+	ap.ClearScreen()
+	t.draw(ap)
+	err := ap.FPSTicks(func() bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		changed := t.collect()
+		if len(ap.Data) > 0 {
+			if !t.key(ctx, ap.Data) {
+				return false
+			}
+			changed = true
+		}
+		if changed {
+			t.draw(ap)
+		}
+		return true
+	})
+	ap.ClearScreen()
+	ap.Restore()
+	if errors.Is(err, terminal.ErrSignal) {
+		err = nil
+	}
+
+	c.matchedLines = len(t.matches)
+	if t.chosen && t.selected < len(t.matches) {
+		m := t.matches[t.selected]
+		fmt.Printf("%s:%d:%d\n", m.Path, m.Line, m.Column)
+	}
+	return err
+}
+
+// setPattern replaces the pattern and starts searching for it, canceling the search of
+// the previous one. An invalid pattern leaves the previous results in place.
+func (t *tui) setPattern(ctx context.Context, pattern string) {
+	t.pattern = pattern
+	t.err = nil
+	if pattern == "" {
+		t.stop()
+		t.matches, t.selected, t.top = nil, 0, 0
+		return
+	}
+	m, err := search.NewMatcher(strings.Split(pattern, "\n"), t.c.matcherOptions)
+	if err != nil {
+		t.err = err
+		return
+	}
+	t.stop()
+	t.matches, t.selected, t.top = nil, 0, 0
+	// The matcher also expands the -replace template shown in place of the matches.
+	t.c.matcher = m
+
+	opts := t.c.searchOptions()
+	opts.Matcher = m
+	// Skipped files would only scroll over the view.
+	opts.OnSkip = nil
+	if opts.MaxTotal == 0 || opts.MaxTotal > tuiMaxResults {
+		opts.MaxTotal = tuiMaxResults
+	}
+	ctx, t.cancel = context.WithCancel(ctx)
+	t.searching = true
+	go t.search(ctx, search.New(opts), t.gen)
+}
+
+// stop cancels the running search, if any, and makes sure its results are dropped.
+func (t *tui) stop() {
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+	t.gen++
+	t.searching = false
+}
+
+// search runs in its own goroutine, sending the matches of s to t.results.
+func (t *tui) search(ctx context.Context, s *search.Searcher, gen int) {
+	for m, err := range s.Search(ctx, t.roots...) {
+		select {
+		case t.results <- tuiResult{gen: gen, match: m, err: err}:
+		case <-ctx.Done():
+			return
+		}
+	}
+	select {
+	case t.results <- tuiResult{gen: gen, done: true}:
+	case <-ctx.Done():
+	}
+}
+
+// collect adds the results received since the last call, telling whether anything
+// changed.
+func (t *tui) collect() bool {
+	changed := false
+	for {
+		select {
+		case r := <-t.results:
+			if r.gen != t.gen {
+				continue
+			}
+			changed = true
+			switch {
+			case r.done:
+				t.searching = false
+			case r.err != nil:
+				t.err = r.err
+			default:
+				t.matches = append(t.matches, r.match)
+			}
+		default:
+			return changed
+		}
+	}
+}
+
+// key handles the keys read from the terminal, returning false to quit. Typing edits
+// the pattern, the arrows and page keys move the selection, enter picks it and escape
+// or Ctrl-C quit.
+func (t *tui) key(ctx context.Context, data []byte) bool {
+	pattern := t.pattern
+	for len(data) > 0 {
+		b := data[0]
+		switch {
+		case b == 0x1b && len(data) == 1:
+			return false
+		case b == 0x1b:
+			n := escapeLen(data)
+			switch string(data[:n]) {
+			case "\x1b[A", "\x1bOA":
+				t.move(-1)
+			case "\x1b[B", "\x1bOB":
+				t.move(1)
+			case "\x1b[5~":
+				t.move(-t.rows)
+			case "\x1b[6~":
+				t.move(t.rows)
+			}
+			data = data[n:]
+			continue
+		case b == 3 || b == 4:
+			return false
+		case b == '\r' || b == '\n':
+			t.chosen = true
+			return false
+		case b == 127 || b == 8:
+			_, size := utf8.DecodeLastRuneInString(pattern)
+			pattern = pattern[:len(pattern)-size]
+		case b == 21: // Ctrl-U
+			pattern = ""
+		case b == 16: // Ctrl-P
+			t.move(-1)
+		case b == 14: // Ctrl-N
+			t.move(1)
+		case b < ' ':
+		default:
+			r, size := utf8.DecodeRune(data)
+			if r != utf8.RuneError {
+				pattern += string(data[:size])
+			}
+			data = data[size:]
+			continue
+		}
+		data = data[1:]
+	}
+	if pattern != t.pattern {
+		t.setPattern(ctx, pattern)
+	}
+	return true
+}
+
+// escapeLen is the length of the escape sequence data starts with: ESC followed by a
+// CSI or SS3 sequence, or by a single character.
+func escapeLen(data []byte) int {
+	if len(data) < 2 {
+		return len(data)
+	}
+	switch data[1] {
+	case '[':
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(data)
+	case 'O':
+		return min(3, len(data))
+	}
+	return 2
+}
+
+// move moves the selection by delta matches, staying within the list.
+func (t *tui) move(delta int) {
+	t.selected = max(0, min(t.selected+delta, len(t.matches)-1))
+}
+
+// draw renders the whole view: the pattern and the search status, the list of
+// matches, and below it a preview of the lines around the selected match.
+func (t *tui) draw(ap *ansipixels.AnsiPixels) {
+	t.rows = max(1, (ap.H-3)/2)
+	if t.selected < t.top {
+		t.top = t.selected
+	}
+	if t.selected >= t.top+t.rows {
+		t.top = t.selected - t.rows + 1
+	}
+
+	y := 0
+	line := func(s string) {
+		ap.MoveCursor(0, y)
+		ap.WriteString(fitWidth(s, ap.W))
+		ap.WriteString(WHITE)
+		ap.ClearEndOfLine()
+		y++
+	}
+	line(fmt.Sprintf("%s> %s%s", BLUE, WHITE, t.pattern))
+	line(t.status())
+
+	var b strings.Builder
+	for i := t.top; i < t.top+t.rows; i++ {
+		if i >= len(t.matches) {
+			line("")
+			continue
+		}
+		b.Reset()
+		if i == t.selected {
+			b.WriteString(GREEN + "> ")
+		} else {
+			b.WriteString("  ")
+		}
+		m := t.matches[i]
+		fmt.Fprintf(&b, "%s%s%s:%d: %s", BLUE, m.Path, RED, m.Line, WHITE)
+		end := len(m.Text)
+		if j := strings.IndexByte(m.Text, '\n'); j >= 0 {
+			end = j
+		}
+		t.c.writeHighlighted(&b, m, 0, end, true, m.EndLine == m.Line)
+		line(b.String())
+	}
+
+	if t.selected < len(t.matches) {
+		m := t.matches[t.selected]
+		line(fmt.Sprintf("── %s%s%s ", BLUE, m.Path, WHITE) + strings.Repeat("─", ap.W))
+		for _, s := range t.preview(m, ap.H-y) {
+			line(s)
+		}
+	} else {
+		line(strings.Repeat("─", ap.W))
+	}
+	for y < ap.H {
+		line("")
+	}
+	ap.MoveCursor(2+utf8.RuneCountInString(t.pattern), 0)
+}
+
+// status describes the state of the search, or why the pattern is invalid.
+func (t *tui) status() string {
+	switch {
+	case t.err != nil:
+		return RED + t.err.Error()
+	case t.pattern == "":
+		return "type a pattern, arrows to move, enter to pick, esc to quit"
+	}
+	s := fmt.Sprintf("%d matches", len(t.matches))
+	if len(t.matches) >= tuiMaxResults {
+		s = fmt.Sprintf("first %d matches", len(t.matches))
+	}
+	if t.searching {
+		s += ", searching..."
+	}
+	return s
+}
+
+// preview returns up to rows numbered lines of the file of m, centered on the lines m
+// covers, whose numbers are highlighted.
+func (t *tui) preview(m search.Match, rows int) []string {
+	if m.Path != t.previewPath {
+		t.previewPath = m.Path
+		data, err := os.ReadFile(m.Path)
+		t.previewLines, t.previewErr = strings.Split(string(data), "\n"), err
+	}
+	if t.previewErr != nil {
+		return []string{RED + t.previewErr.Error()}
+	}
+	first := max(1, m.Line-(rows-(m.EndLine-m.Line+1))/2)
+	var lines []string
+	for n := first; n < first+rows && n <= len(t.previewLines); n++ {
+		color := RED
+		if n >= m.Line && n <= m.EndLine {
+			color = GREEN
+		}
+		text := strings.TrimSuffix(t.previewLines[n-1], "\r")
+		lines = append(lines, fmt.Sprintf("%s%4d %s%s", color, n, WHITE, text))
+	}
+	return lines
+}
+
+// fitWidth cuts s down to width characters, not counting color codes, and turns tabs
+// into spaces and other control characters into blanks so that they can't move the
+// cursor.
+func fitWidth(s string, width int) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(s) && n < width; {
+		if s[i] == 0x1b {
+			j := strings.IndexByte(s[i:], 'm')
+			if j < 0 {
+				break
+			}
+			b.WriteString(s[i : i+j+1])
+			i += j + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == '\t':
+			for spaces := 4 - n%4; spaces > 0 && n < width; spaces-- {
+				b.WriteByte(' ')
+				n++
+			}
+			continue
+		case r < ' ':
+			r = ' '
+		}
+		b.WriteRune(r)
+		n++
+	}
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fortio.org/terminal/ansipixels"
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestTUIFlagValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "WithText", args: []string{"gorep", "-tui", "-text", "test", "some text"}},
+		{name: "WithWrite", args: []string{"gorep", "-tui", "-f", ".", "-write", "-replace", "x", "test"}},
+		{name: "WithQuiet", args: []string{"gorep", "-tui", "-q", "test"}},
+		{name: "WithOutput", args: []string{"gorep", "-tui", "-o", "out.txt", "test"}},
+		{name: "WithWatch", args: []string{"gorep", "-tui", "-watch", "-f", ".", "test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ConfigureWithArgs(tt.args); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	// The pattern can be typed, or fixed, once the view is open.
+	for _, args := range [][]string{{"gorep", "-tui"}, {"gorep", "-tui", "("}} {
+		if _, err := ConfigureWithArgs(args); err != nil {
+			t.Errorf("ConfigureWithArgs(%q) failed: %v", args, err)
+		}
+	}
+
+	// -i is short for -tui, and doesn't get in the way of -in.
+	c, err := ConfigureWithArgs([]string{"gorep", "-i", "-in", "comments", "todo"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if !c.tui || c.scope != search.ScopeComments {
+		t.Errorf("Expected -i to open the view with -in applying, got tui %v and scope %v", c.tui, c.scope)
+	}
+}
+
+// newTestTUI returns a tui searching dir, configured by the flags in args.
+func newTestTUI(t *testing.T, dir string, args ...string) *tui {
+	t.Helper()
+	c, err := ConfigureWithArgs(append([]string{"gorep", "-tui", "-f", dir}, args...))
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	return newTUI(c, "")
+}
+
+// waitSearch collects the results of the running search until it's done.
+func waitSearch(t *testing.T, ui *tui) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for ui.searching {
+		if time.Now().After(deadline) {
+			t.Fatal("The search didn't complete")
+		}
+		ui.collect()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTUISearch(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("foo\nbar\nfoobar\n"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("FOO\n"), 0o644)
+	ui := newTestTUI(t, tempDir, "-ignore-case")
+	ctx := context.Background()
+
+	ui.setPattern(ctx, "foo")
+	waitSearch(t, ui)
+	if len(ui.matches) != 3 || ui.err != nil {
+		t.Fatalf("Expected 3 matches, got %d (%v)", len(ui.matches), ui.err)
+	}
+	if s := ui.status(); s != "3 matches" {
+		t.Errorf("Unexpected status %q", s)
+	}
+
+	ui.setPattern(ctx, "foo(")
+	if ui.err == nil || len(ui.matches) != 3 {
+		t.Errorf("Expected an invalid pattern to keep the results, got %d matches (%v)", len(ui.matches), ui.err)
+	}
+	if s := ui.status(); !strings.HasPrefix(s, RED) {
+		t.Errorf("Expected the error to be shown, got %q", s)
+	}
+
+	ui.setPattern(ctx, "foo(bar)")
+	waitSearch(t, ui)
+	if len(ui.matches) != 1 || ui.matches[0].Line != 3 {
+		t.Errorf("Expected the new pattern to be searched, got %v", ui.matches)
+	}
+
+	ui.setPattern(ctx, "")
+	if len(ui.matches) != 0 || ui.searching {
+		t.Errorf("Expected an empty pattern to clear the results, got %v", ui.matches)
+	}
+}
+
+func TestTUIDropsStaleResults(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.WriteFile(filepath.Join(tempDir, name), []byte("abc\n"), 0o644)
+	}
+	ui := newTestTUI(t, tempDir)
+	ctx := context.Background()
+
+	ui.setPattern(ctx, "a")
+	ui.setPattern(ctx, "ab")
+	ui.setPattern(ctx, "xyz")
+	waitSearch(t, ui)
+	time.Sleep(10 * time.Millisecond)
+	ui.collect()
+	if len(ui.matches) != 0 {
+		t.Errorf("Expected the results of earlier patterns to be dropped, got %v", ui.matches)
+	}
+}
+
+func TestTUIKey(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("ab\nab\nab\nac\n"), 0o644)
+	ui := newTestTUI(t, tempDir)
+	ctx := context.Background()
+
+	if !ui.key(ctx, []byte("abx\x7f")) || ui.pattern != "ab" {
+		t.Fatalf("Expected typing to edit the pattern, got %q", ui.pattern)
+	}
+	waitSearch(t, ui)
+	if len(ui.matches) != 3 {
+		t.Fatalf("Expected 3 matches, got %d", len(ui.matches))
+	}
+
+	ui.key(ctx, []byte("\x1b[B\x1b[B\x1b[B"))
+	if ui.selected != 2 {
+		t.Errorf("Expected the selection to stop at the last match, got %d", ui.selected)
+	}
+	ui.key(ctx, []byte("\x1bOA"))
+	if ui.selected != 1 {
+		t.Errorf("Expected the selection to move up, got %d", ui.selected)
+	}
+	ui.key(ctx, []byte("\x1b[5~"))
+	if ui.selected != 0 || ui.pattern != "ab" {
+		t.Errorf("Expected page up to move to the top, got %d and %q", ui.selected, ui.pattern)
+	}
+
+	ui.key(ctx, []byte("\x15é"))
+	if ui.pattern != "é" {
+		t.Errorf("Expected Ctrl-U to clear the pattern, got %q", ui.pattern)
+	}
+	ui.key(ctx, []byte{0x7f})
+	if ui.pattern != "" {
+		t.Errorf("Expected backspace to remove a whole character, got %q", ui.pattern)
+	}
+
+	if ui.key(ctx, []byte("\r")) || !ui.chosen {
+		t.Error("Expected enter to pick the selected match")
+	}
+	for _, quit := range []string{"\x1b", "\x03", "\x04"} {
+		if ui.key(ctx, []byte(quit)) {
+			t.Errorf("Expected %q to quit", quit)
+		}
+	}
+}
+
+func TestTUIDraw(t *testing.T) {
+	tempDir := t.TempDir()
+	file := filepath.Join(tempDir, "a.go")
+	os.WriteFile(file, []byte("package a\n\nfunc A() {\n\treturn\n}\n"), 0o644)
+	ui := newTestTUI(t, tempDir)
+	ui.setPattern(context.Background(), "func")
+	waitSearch(t, ui)
+
+	var out strings.Builder
+	w := bufio.NewWriter(&out)
+	ap := &ansipixels.AnsiPixels{Out: w, W: 40, H: 9}
+	ui.draw(ap)
+	w.Flush()
+
+	screen := stripColors(out.String())
+	for _, want := range []string{
+		"> func",
+		"1 matches",
+		"> " + file[:20],
+		"   2 \x1b[K",
+		"   3 func A() {",
+		"   4    return",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("Expected %q on screen, got %q", want, screen)
+		}
+	}
+	if ui.rows != 3 {
+		t.Errorf("Expected 3 rows of matches, got %d", ui.rows)
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{in: "hello", width: 10, want: "hello"},
+		{in: "hello", width: 3, want: "hel"},
+		{in: GREEN + "héllo" + WHITE, width: 2, want: GREEN + "hé"},
+		{in: "a\tb", width: 10, want: "a   b"},
+		{in: "a\tb", width: 3, want: "a  "},
+		{in: "a\rb", width: 10, want: "a b"},
+	}
+	for _, tt := range tests {
+		if got := fitWidth(tt.in, tt.width); got != tt.want {
+			t.Errorf("fitWidth(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+// watchDebounce is how long -watch waits for changes to settle before searching again,
+// so that an editor saving, or a checkout touching many files, yields a single update.
+const watchDebounce = 150 * time.Millisecond
+
+// pollInterval is how often pollTree walks the tree looking for changes.
+var pollInterval = time.Second
+
+// watch keeps gorep running once the directories roots have been searched: changes
+// under them are gathered until they settle, then the files concerned are searched again
+// and their new results printed, followed by the running count of matching lines. It
+// returns when ctx is canceled, e.g. by an interrupt.
+func (c *config) watch(ctx context.Context, roots []string) error {
+	fmt.Println(c.watchSummary())
+
+	type rootError struct {
+		root string
+		err  error
+	}
+	changes := make(chan string)
+	watchErr := make(chan rootError, len(roots))
+	ignored := c.searcher().Ignored
+	for _, root := range roots {
+		go func() { watchErr <- rootError{root, watchTree(ctx, root, ignored, changes)} }()
+	}
+
+	pending := make(map[string]bool)
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-watchErr:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("can't watch %s: %w", e.root, e.err)
+		case path := <-changes:
+			pending[path] = true
+			settled = time.After(watchDebounce)
+		case <-settled:
+			settled = nil
+			if err := c.research(ctx, slices.Sorted(maps.Keys(pending))); err != nil {
+				return err
+			}
+			clear(pending)
+			fmt.Println(c.watchSummary())
+		}
+	}
+}
+
+// research searches the changed paths, files or directories, again. Their previous
+// results are dropped, and files that no longer match are reported as such.
+func (c *config) research(ctx context.Context, paths []string) error {
+	// A new Searcher so -max-total and -stats apply to each update on its own.
+	c.engine = search.New(c.searchOptions())
+	var roots, dirs []string
+	var stale []string
+	for _, path := range paths {
+		for file := range c.watched {
+			if file == path || strings.HasPrefix(file, path+string(filepath.Separator)) {
+				stale = append(stale, file)
+				delete(c.watched, file)
+			}
+		}
+		if info, err := os.Stat(path); err == nil {
+			roots = append(roots, path)
+			if info.IsDir() {
+				dirs = append(dirs, path)
+			}
+		}
+	}
+	// The files of a new directory come along with it, and are found searching it. The
+	// others are searched as roots, which skip the filters of directory searches.
+	roots = slices.DeleteFunc(pruneRoots(roots, dirs), func(root string) bool {
+		return !slices.Contains(dirs, root) && !c.engine.Wanted(root)
+	})
+
+	if len(roots) > 0 {
+		if err := c.searchFiles(ctx, roots, true, nil); err != nil {
+			return err
+		}
+	}
+	slices.Sort(stale)
+	for _, file := range stale {
+		if c.watched[file] == 0 {
+			fmt.Printf("%s%sno matches left\n", c.fileName(file), WHITE)
+		}
+	}
+	return nil
+}
+
+// watchSummary is the running count printed by -watch after each update.
+func (c *config) watchSummary() string {
+	lines := 0
+	for _, n := range c.watched {
+		lines += n
+	}
+	return fmt.Sprintf("%d matching lines in %d files, watching for changes", lines, len(c.watched))
+}
+
+// fileState is what pollTree compares to tell a file changed.
+type fileState struct {
+	size    int64
+	modTime int64
+}
+
+// pollTree is the portable watchTree: it walks root every pollInterval and reports the
+// files that appeared, disappeared, or whose size or modification time changed.
+func pollTree(ctx context.Context, root string, ignored func(string) bool, changes chan<- string) error {
+	previous := snapshotTree(root, ignored)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current := snapshotTree(root, ignored)
+		var changed []string
+		for path, state := range current {
+			if old, ok := previous[path]; !ok || old != state {
+				changed = append(changed, path)
+			}
+		}
+		for path := range previous {
+			if _, ok := current[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+		previous = current
+
+		for _, path := range changed {
+			select {
+			case changes <- path:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// snapshotTree records the state of the files under root, leaving out ignored names.
+func snapshotTree(root string, ignored func(string) bool) map[string]fileState {
+	states := make(map[string]fileState)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != root && ignored(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			states[path] = fileState{size: info.Size(), modTime: info.ModTime().UnixNano()}
+		}
+		return nil
+	})
+	return states
+}
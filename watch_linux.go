@@ -0,0 +1,139 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// watchTree sends the paths that change under root to changes until ctx is canceled.
+// It uses inotify, and falls back to polling when that's not possible, typically when
+// the tree has more directories than fs.inotify.max_user_watches allows.
+func watchTree(ctx context.Context, root string, ignored func(string) bool, changes chan<- string) error {
+	w, err := newInotify(root, ignored)
+	if err != nil {
+		log.Printf("can't use inotify (%v), polling for changes instead\n", err)
+		return pollTree(ctx, root, ignored, changes)
+	}
+	return w.run(ctx, changes)
+}
+
+// inotifyMask selects the events of interest: files written or moved, and directories
+// created, moved or deleted.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotify watches every directory of a tree, inotify watches not being recursive.
+type inotify struct {
+	fd   int
+	file *os.File
+	// dirs maps watch descriptors to the directory they watch.
+	dirs    map[int32]string
+	ignored func(string) bool
+}
+
+func newInotify(root string, ignored func(string) bool) (*inotify, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	// Non-blocking, the descriptor goes through the runtime poller: reads block without
+	// holding a thread, and closing the file interrupts them.
+	w := &inotify{fd: fd, file: os.NewFile(uintptr(fd), "inotify"), dirs: make(map[int32]string), ignored: ignored}
+	if err := w.addTree(root); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// addTree watches dir and the directories under it, except ignored ones. Directories
+// that can't be watched are left out, unless the watch limit is reached.
+func (w *inotify) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != dir && w.ignored(d.Name()) {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if errors.Is(err, syscall.ENOSPC) {
+			return err
+		}
+		if err == nil {
+			w.dirs[int32(wd)] = path
+		}
+		return nil
+	})
+}
+
+// run reads events until ctx is canceled, sending the paths they concern to changes.
+func (w *inotify) run(ctx context.Context, changes chan<- string) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		w.file.Close()
+	}()
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			path, ok := w.handle(event, strings.TrimRight(string(buf[nameStart:offset]), "\x00"))
+			if !ok {
+				continue
+			}
+			select {
+			case changes <- path:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// handle keeps the watches up to date with the event and tells which path, if any, it
+// reports a change of. New files are reported once written rather than when created.
+func (w *inotify) handle(event *syscall.InotifyEvent, name string) (string, bool) {
+	if event.Mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, event.Wd)
+		return "", false
+	}
+	dir, ok := w.dirs[event.Wd]
+	if !ok || name == "" || w.ignored(name) {
+		return "", false
+	}
+	path := filepath.Join(dir, name)
+	if event.Mask&syscall.IN_ISDIR == 0 {
+		return path, event.Mask&syscall.IN_CREATE == 0
+	}
+	if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		if err := w.addTree(path); err != nil {
+			log.Printf("can't watch %s: %v\n", path, err)
+		}
+	}
+	return path, true
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInotify(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Mkdir(filepath.Join(tempDir, "vendor"), 0o755)
+
+	w, err := newInotify(tempDir, func(name string) bool { return name == "vendor" })
+	if err != nil {
+		t.Skipf("inotify isn't available: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string)
+	done := make(chan error)
+	go func() { done <- w.run(ctx, changes) }()
+
+	next := func() string {
+		select {
+		case path := <-changes:
+			return path
+		case <-time.After(2 * time.Second):
+			t.Fatal("No change reported")
+			return ""
+		}
+	}
+
+	os.WriteFile(filepath.Join(tempDir, "vendor", "dep.txt"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("x"), 0o644)
+	if path := next(); path != filepath.Join(tempDir, "a.txt") {
+		t.Errorf("Expected a.txt to change, got %s", path)
+	}
+
+	sub := filepath.Join(tempDir, "sub")
+	os.Mkdir(sub, 0o755)
+	if path := next(); path != sub {
+		t.Errorf("Expected the new directory to be reported, got %s", path)
+	}
+	os.WriteFile(filepath.Join(sub, "b.txt"), []byte("x"), 0o644)
+	if path := next(); path != filepath.Join(sub, "b.txt") {
+		t.Errorf("Expected the new directory to be watched, got %s", path)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected run to stop cleanly, got %v", err)
+	}
+}
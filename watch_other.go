@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "context"
+
+// watchTree sends the paths that change under root to changes until ctx is canceled.
+// Without inotify, the tree is polled.
+func watchTree(ctx context.Context, root string, ignored func(string) bool, changes chan<- string) error {
+	return pollTree(ctx, root, ignored, changes)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geofpwhite/gorep/search"
+)
+
+func TestWatchFlagValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "WithoutFile", args: []string{"gorep", "-watch", "test"}},
+		{name: "WithWrite", args: []string{"gorep", "-watch", "-f", ".", "-write", "-replace", "x", "test"}},
+		{name: "WithQuiet", args: []string{"gorep", "-watch", "-f", ".", "-q", "test"}},
+		{name: "WithOutput", args: []string{"gorep", "-watch", "-f", ".", "-o", "out.txt", "test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ConfigureWithArgs(tt.args); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-watch", "-f", "main.go", "test"})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	if got := c.Main(context.Background()); got != 2 {
+		t.Errorf("Expected exit code 2 watching a single file, got %d", got)
+	}
+}
+
+func TestResearch(t *testing.T) {
+	tempDir := t.TempDir()
+	a := filepath.Join(tempDir, "a.txt")
+	os.WriteFile(a, []byte("test\ntest\n"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0o755)
+	b := filepath.Join(tempDir, "sub", "b.txt")
+	os.WriteFile(b, []byte("test\n"), 0o644)
+
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, "", nil, 2)
+	c.watched = make(map[string]int)
+	ctx := context.Background()
+	if err := c.searchDirectory(ctx, tempDir, nil); err != nil {
+		t.Fatalf("searchDirectory failed: %v", err)
+	}
+	if s := c.watchSummary(); s != "3 matching lines in 2 files, watching for changes" {
+		t.Errorf("Unexpected summary %q", s)
+	}
+
+	os.WriteFile(a, []byte("no match\ntest\n"), 0o644)
+	if err := c.research(ctx, []string{a}); err != nil {
+		t.Fatalf("research failed: %v", err)
+	}
+	if c.watched[a] != 1 || c.watched[b] != 1 {
+		t.Errorf("Expected a.txt to be searched again, got %v", c.watched)
+	}
+
+	// A new directory and its file, changed at once.
+	os.MkdirAll(filepath.Join(tempDir, "new", "n"), 0o755)
+	z := filepath.Join(tempDir, "new", "n", "z.txt")
+	os.WriteFile(z, []byte("test\n"), 0o644)
+	if err := c.research(ctx, []string{filepath.Join(tempDir, "new"), filepath.Join(tempDir, "new", "n"), z}); err != nil {
+		t.Fatalf("research failed: %v", err)
+	}
+	if c.watched[z] != 1 {
+		t.Errorf("Expected z.txt to be searched once, got %v", c.watched)
+	}
+	if s := c.watchSummary(); s != "3 matching lines in 3 files, watching for changes" {
+		t.Errorf("Unexpected summary %q", s)
+	}
+	os.RemoveAll(filepath.Join(tempDir, "new"))
+	if err := c.research(ctx, []string{filepath.Join(tempDir, "new")}); err != nil {
+		t.Fatalf("research failed: %v", err)
+	}
+
+	os.RemoveAll(filepath.Join(tempDir, "sub"))
+	if err := c.research(ctx, []string{filepath.Join(tempDir, "sub")}); err != nil {
+		t.Fatalf("research failed: %v", err)
+	}
+	if len(c.watched) != 1 {
+		t.Errorf("Expected the files of a removed directory to be dropped, got %v", c.watched)
+	}
+}
+
+func TestResearchFilters(t *testing.T) {
+	tempDir := t.TempDir()
+	big := filepath.Join(tempDir, "big.go")
+	os.WriteFile(big, []byte(strings.Repeat("// test\n", 50)), 0o644)
+	other := filepath.Join(tempDir, "other.txt")
+	os.WriteFile(other, []byte("// test\n"), 0o644)
+
+	c := newConfig(search.Regexp(regexp.MustCompile("test")), true, tempDir, "", nil, 2)
+	c.watched = make(map[string]int)
+	c.maxFileSize = 20
+	c.scope = search.ScopeComments
+	c.noMessages = true
+	ctx := context.Background()
+	if err := c.searchDirectory(ctx, tempDir, nil); err != nil {
+		t.Fatalf("searchDirectory failed: %v", err)
+	}
+
+	os.WriteFile(big, []byte(strings.Repeat("// test\n", 51)), 0o644)
+	os.WriteFile(other, []byte("// test\n// test\n"), 0o644)
+	if err := c.research(ctx, []string{big, other}); err != nil {
+		t.Fatalf("research failed: %v", err)
+	}
+	if len(c.watched) != 0 {
+		t.Errorf("Expected the changed files to be left out like the first time, got %v", c.watched)
+	}
+}
+
+func TestPollTree(t *testing.T) {
+	defer func(d time.Duration) { pollInterval = d }(pollInterval)
+	pollInterval = 10 * time.Millisecond
+
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0o644)
+	os.Mkdir(filepath.Join(tempDir, "vendor"), 0o755)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string)
+	ignored := func(name string) bool { return name == "vendor" }
+	go pollTree(ctx, tempDir, ignored, changes)
+
+	time.Sleep(3 * pollInterval)
+	os.WriteFile(filepath.Join(tempDir, "vendor", "dep.txt"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("ab"), 0o644)
+	select {
+	case path := <-changes:
+		if path != filepath.Join(tempDir, "a.txt") {
+			t.Errorf("Expected a.txt to change, got %s", path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No change reported")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tempDir, otherDir := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("test\n"), 0o644)
+
+	c, err := ConfigureWithArgs([]string{"gorep", "-watch", "test", tempDir, otherDir})
+	if err != nil {
+		t.Fatalf("ConfigureWithArgs failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	status := make(chan int)
+	go func() { status <- c.Main(ctx) }()
+
+	time.Sleep(100 * time.Millisecond)
+	os.WriteFile(filepath.Join(otherDir, "b.txt"), []byte("test\ntest\n"), 0o644)
+	time.Sleep(watchDebounce + 500*time.Millisecond)
+	cancel()
+
+	if got := <-status; got != 0 {
+		t.Errorf("Expected exit code 0, got %d", got)
+	}
+	if s := c.watchSummary(); s != "3 matching lines in 2 files, watching for changes" {
+		t.Errorf("Expected the new file to be searched, got %q", s)
+	}
+}